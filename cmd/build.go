@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/getopendroplet/droplet/dropletfile/builder"
 	"github.com/getopendroplet/droplet/dropletfile/instructions"
@@ -13,59 +17,189 @@ import (
 
 type cmdBuild struct {
 	global *cmdGlobal
+
+	flagBuildArgs []string
+	flagBuilder   string
+	flagContext   string
+	flagManifest  string
+	flagInstance  string
+	flagOutput    string
+	flagStages    []string
+	flagAllStages bool
+	flagStrict    bool
 }
 
 func (c *cmdBuild) Command() *cobra.Command {
-	return &cobra.Command{
-		Use:   "build <dropletfile> <stage>",
+	cmd := &cobra.Command{
+		Use:   "build <dropletfile> [<stage>]",
 		Short: "Build an script from a Dropletfile",
-		Args:  cobra.ExactArgs(2),
-		RunE:  c.Run,
+		Long: `Build an script from a Dropletfile
+
+Several stages can be built in a single script with --stage, or all of them
+with --all-stages. The stages a stage depends on are built before it.
+
+COPY sources are read from the build context, the dir of the Dropletfile
+unless --context is given. The files matched by its .dropletignore file are
+never copied, and the copied files are checked against their SHA-256 once
+copied.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: c.Run,
 	}
+
+	cmd.Flags().StringArrayVar(&c.flagBuildArgs, "build-arg", nil, "Set a build arg as KEY=VALUE, or KEY to read it from the environment")
+	cmd.Flags().StringVar(&c.flagBuilder, "builder", "", "Builder used to build the script, overrides the builder config")
+	cmd.Flags().StringVar(&c.flagContext, "context", "", "Dir of the files used by COPY and CONFIG, defaults to the dir of the Dropletfile")
+	cmd.Flags().StringVar(&c.flagManifest, "manifest", "", "Write the SHA-256 of the copied files to a file, in the sha256sum format")
+	cmd.Flags().StringVar(&c.flagInstance, "instance", "", "Name of the instance targeted by the lxd builder")
+	cmd.Flags().BoolVar(&c.flagStrict, "strict", false, "Fail on unknown instructions instead of ignoring them")
+	cmd.Flags().StringArrayVar(&c.flagStages, "stage", nil, "Stage to build, can be repeated")
+	cmd.Flags().BoolVar(&c.flagAllStages, "all-stages", false, "Build all the stages of the Dropletfile")
+	cmd.Flags().StringVarP(&c.flagOutput, "output", "o", "-", "Write the script to a file (- for stdout)")
+	return cmd
 }
 
 func (c *cmdBuild) Run(cmd *cobra.Command, args []string) error {
 	conf := c.global.conf
-	fileName := args[0]
-	stageName := args[1]
+	fileName := filepath.Join(args[0], "Dropletfile")
+	stageNames := append([]string{}, args[1:]...)
+	stageNames = append(stageNames, c.flagStages...)
+	if c.flagAllStages && len(stageNames) > 0 {
+		return errors.New("--all-stages can't be used with named stages")
+	}
+	if !c.flagAllStages && len(stageNames) == 0 {
+		return errors.New("no build stage given, use --stage or --all-stages")
+	}
+
+	if err := c.global.LoadPackageManagers(); err != nil {
+		return err
+	}
 
 	var f *os.File
 	var err error
 
-	f, err = os.Open(fileName + "/Dropletfile")
+	f, err = os.Open(fileName)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	result, err := parser.Parse(f)
+	result, err := parser.ParseWithOptions(f, parser.Options{Strict: c.flagStrict})
 	if err != nil {
 		return err
 	}
+	if !c.global.flagQuiet {
+		result.PrintWarnings(os.Stderr)
+	}
 
-	stages, _, err := instructions.Parse(result.AST)
+	buildArgs, err := c.buildArgs()
 	if err != nil {
 		return err
 	}
 
-	index, exists := instructions.HasStage(stages, stageName)
-	if !exists {
-		return errors.Errorf("no build stage %s in current Dropletfile", stageName)
+	stages, metaArgs, err := instructions.Parse(result.AST)
+	if err != nil {
+		return err
 	}
 
-	stage := stages[index]
+	if c.flagAllStages {
+		for _, stage := range stages {
+			stageNames = append(stageNames, stage.Name)
+		}
+	}
+	for i, name := range stageNames {
+		stageNames[i] = strings.ToLower(name)
+	}
 
-	builder.Build(conf, stage.Commands)
-	// json, err := json.Marshal(stage)
-	// if err != nil {
-	// 	return err
-	// }
+	buildStages, err := instructions.ResolveStages(stages, stageNames)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(buildStages))
+	for i, stage := range buildStages {
+		names[i] = stage.Name
+	}
 
-	// fmt.Println(string(json))
+	var progress io.Writer = ioutil.Discard
+	if c.global.flagLogVerbose && !c.global.flagQuiet {
+		progress = os.Stderr
+	}
+
+	contextDir := c.flagContext
+	if contextDir == "" {
+		contextDir = args[0]
+	}
 
+	c.global.Progress("Building stage %s from %s\n", strings.Join(names, ", "), fileName)
+	script, err := builder.Build(conf, buildStages, builder.BuildOpts{
+		Builder:     c.flagBuilder,
+		Dropletfile: fileName,
+		ContextDir:  contextDir,
+		EscapeToken: result.EscapeToken,
+		MetaArgs:    metaArgs,
+		BuildArgs:   buildArgs,
+		Instance:    c.flagInstance,
+		Progress:    progress,
+	})
+	if err != nil {
+		return err
+	}
+	for _, warning := range script.Warnings {
+		c.global.Progress("%s\n", warning)
+	}
+
+	if c.flagManifest != "" {
+		var manifest strings.Builder
+		for _, entry := range script.Manifest {
+			manifest.WriteString(entry.String() + "\n")
+		}
+		if err := ioutil.WriteFile(c.flagManifest, []byte(manifest.String()), 0644); err != nil {
+			return err
+		}
+	}
+
+	if c.flagOutput == "-" {
+		_, err = script.WriteTo(os.Stdout)
+		return err
+	}
+
+	out, err := os.OpenFile(c.flagOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := script.WriteTo(out); err != nil {
+		return err
+	}
+
+	// The script is run as is, it's made executable whatever the umask and
+	// the mode of the file it replaces
+	if err := out.Chmod(0755); err != nil {
+		return err
+	}
+
+	c.global.Progress("Script written to %s\n", c.flagOutput)
 	return nil
 }
 
+func (c *cmdBuild) buildArgs() (map[string]string, error) {
+	buildArgs := map[string]string{}
+	for _, arg := range c.flagBuildArgs {
+		fields := strings.SplitN(arg, "=", 2)
+		if fields[0] == "" {
+			return nil, errors.Errorf("Invalid build arg: %s", arg)
+		}
+
+		if len(fields) == 2 {
+			buildArgs[fields[0]] = fields[1]
+		} else if value, ok := os.LookupEnv(fields[0]); ok {
+			buildArgs[fields[0]] = value
+		}
+	}
+
+	return buildArgs, nil
+}
+
 func init() {
 	buildCmd := cmdBuild{global: &globalCmd}
 	rootCmd.AddCommand(buildCmd.Command())
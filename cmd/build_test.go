@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getopendroplet/droplet/config"
+)
+
+func TestBuildOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dropletfile := "STAGE install\nARG VERSION=1.0\nARG NAME=droplet\nARG DROPLET_TEST_OWNER=root\nRUN echo \"$NAME $VERSION\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dropletfile"), []byte(dropletfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing output file is replaced and made executable
+	output := filepath.Join(dir, "install.sh")
+	if err := ioutil.WriteFile(output, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A build arg without a value is read from the environment
+	os.Setenv("DROPLET_TEST_OWNER", "app")
+	defer os.Unsetenv("DROPLET_TEST_OWNER")
+
+	c := cmdBuild{
+		global: &cmdGlobal{
+			conf:          config.NewConfig(true),
+			confPath:      filepath.Join(dir, "config"),
+			workspacePath: filepath.Join(dir, "workspace"),
+			flagQuiet:     true,
+		},
+		flagBuildArgs: []string{"VERSION=2.0", "DROPLET_TEST_OWNER"},
+		flagAllStages: true,
+		flagOutput:    output,
+	}
+	if err := c.Run(nil, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"export VERSION=2.0\n", "export NAME=droplet\n", "export DROPLET_TEST_OWNER=app\n"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected %q in the script\n%s", expected, content)
+		}
+	}
+
+	fi, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Errorf("expected the script mode 0755, got %o", fi.Mode().Perm())
+	}
+}
@@ -3,25 +3,145 @@ package cmd
 // https://github.com/jessfraz/dockfmt/blob/master/format.go
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 
+	"github.com/getopendroplet/droplet/dropletfile/format"
+
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 type cmdFmt struct {
 	global *cmdGlobal
+
+	flagCheck bool
+	flagDiff  bool
+	flagWrite bool
 }
 
 func (c *cmdFmt) Command() *cobra.Command {
-	return &cobra.Command{
-		Use:   "fmt",
+	cmd := &cobra.Command{
+		Use:   "fmt <dropletfile>...",
 		Short: "Format the Dropletfile",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Println("fmt called")
+		Long: `Format the Dropletfile
+
+The formatted Dropletfiles are printed to stdout, unless --write, --diff or
+--check is given. A directory argument formats the Dropletfile it contains.
+With --check, the command fails when a file isn't formatted.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: c.Run,
+	}
+
+	cmd.Flags().BoolVar(&c.flagCheck, "check", false, "List the files which aren't formatted and fail if there is any")
+	cmd.Flags().BoolVarP(&c.flagDiff, "diff", "d", false, "Display the diffs instead of the formatted files")
+	cmd.Flags().BoolVarP(&c.flagWrite, "write", "w", false, "Write the formatted files back to the source files")
+	return cmd
+}
+
+func (c *cmdFmt) Run(cmd *cobra.Command, args []string) error {
+	unformatted := 0
+	for _, arg := range args {
+		fileName := arg
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			fileName = filepath.Join(arg, "Dropletfile")
+		}
+
+		changed, err := c.format(fileName)
+		if err != nil {
+			return errors.Wrap(err, fileName)
+		}
+		if changed {
+			unformatted++
+		}
+	}
+
+	if c.flagCheck && unformatted > 0 {
+		return errors.Errorf("%d Dropletfile(s) not formatted", unformatted)
+	}
+
+	return nil
+}
+
+// format formats a file and returns whether its formatting changed
+func (c *cmdFmt) format(fileName string) (bool, error) {
+	src, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := format.Format(src)
+	if err != nil {
+		return false, err
+	}
+
+	changed := !bytes.Equal(src, res)
+	if !c.flagWrite && !c.flagDiff && !c.flagCheck {
+		_, err = os.Stdout.Write(res)
+		return changed, err
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if c.flagCheck {
+		fmt.Println(fileName)
+	}
+
+	if c.flagDiff {
+		diff, err := diff(fileName, src, res)
+		if err != nil {
+			return true, err
+		}
+		os.Stdout.Write(diff)
+	}
+
+	if c.flagWrite {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return true, err
+		}
+		if err := ioutil.WriteFile(fileName, res, info.Mode().Perm()); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// diff returns the unified diff of two versions of a file, computed by the
+// diff command
+func diff(fileName string, a []byte, b []byte) ([]byte, error) {
+	files := []string{}
+	defer func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}()
+
+	for _, data := range [][]byte{a, b} {
+		f, err := ioutil.TempFile("", "droplet-fmt")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f.Name())
+		_, err = f.Write(data)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			return nil
-		},
+	out, err := exec.Command("diff", "-u", "--label", fileName+".orig", "--label", fileName, files[0], files[1]).Output()
+	if len(out) > 0 {
+		// diff exits with 1 when the files differ
+		err = nil
 	}
+	return out, err
 }
 
 func init() {
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/getopendroplet/droplet/dropletfile/lint"
+	"github.com/getopendroplet/droplet/utils/table"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type cmdLint struct {
+	global *cmdGlobal
+
+	flagFormat    string
+	flagListRules bool
+}
+
+func (c *cmdLint) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lint <dropletfile>...",
+		Short: "Check Dropletfiles for common mistakes",
+		Long: `Check Dropletfiles for common mistakes
+
+The COPY sources are looked up in the dir of the Dropletfile. A rule is
+disabled for an instruction by a comment preceding it:
+
+  # droplet:ignore relative-workdir
+  WORKDIR app
+
+The command fails when an error is found.`,
+		RunE: c.Run,
+	}
+
+	cmd.Flags().StringVarP(&c.flagFormat, "format", "f", lint.FormatText, "Format (text|json|sarif)")
+	cmd.Flags().BoolVar(&c.flagListRules, "list-rules", false, "List the rules instead of checking files")
+	return cmd
+}
+
+func (c *cmdLint) Run(cmd *cobra.Command, args []string) error {
+	if c.flagListRules {
+		return c.listRules()
+	}
+	if len(args) == 0 {
+		return errors.New("no Dropletfile given")
+	}
+
+	diagnostics := []lint.Diagnostic{}
+	for _, arg := range args {
+		fileName := arg
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			fileName = filepath.Join(arg, "Dropletfile")
+		}
+
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		res, err := lint.Lint(f, fileName, filepath.Dir(fileName))
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, fileName)
+		}
+		diagnostics = append(diagnostics, res...)
+	}
+
+	if err := lint.Write(os.Stdout, c.flagFormat, diagnostics); err != nil {
+		return err
+	}
+
+	errs := 0
+	for _, d := range diagnostics {
+		if d.Severity == lint.SeverityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return errors.Errorf("%d error(s) found", errs)
+	}
+
+	return nil
+}
+
+func (c *cmdLint) listRules() error {
+	rules := lint.Rules()
+	header := []string{"NAME", "SEVERITY", "DESCRIPTION"}
+	data := [][]string{}
+	for _, rule := range rules {
+		data = append(data, []string{rule.Name, rule.Severity.String(), rule.Description})
+	}
+
+	format := c.flagFormat
+	if format == lint.FormatText {
+		format = table.TableFormatTable
+	}
+	return table.RenderTable(format, header, data, rules)
+}
+
+func init() {
+	lintCmd := cmdLint{global: &globalCmd}
+	rootCmd.AddCommand(lintCmd.Command())
+}
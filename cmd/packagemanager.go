@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/getopendroplet/droplet/packagemanagers"
+	"github.com/getopendroplet/droplet/utils"
+	"github.com/getopendroplet/droplet/utils/table"
+
+	"github.com/spf13/cobra"
+)
+
+type cmdPackageManager struct {
+	global *cmdGlobal
+}
+
+type cmdPackageManagerList struct {
+	global *cmdGlobal
+
+	flagFormat string
+}
+
+type cmdPackageManagerShow struct {
+	global *cmdGlobal
+
+	flagFormat string
+}
+
+func (c *cmdPackageManager) Command() *cobra.Command {
+	return &cobra.Command{
+		Use:   "package-manager",
+		Short: "Inspect the package managers",
+		Long: fmt.Sprintf(`Inspect the package managers
+
+The package managers are built in, or defined by a <name>.yml file of the %s
+dir of the config dir or of the workspace. A definition replaces the package
+manager of the same name, the ones of the workspace win.`, packagemanagers.ManagersDir),
+	}
+}
+
+func (c *cmdPackageManagerList) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the package managers",
+		Args:    cobra.ExactArgs(0),
+		RunE:    c.Run,
+	}
+
+	cmd.Flags().StringVar(&c.flagFormat, "format", "table", "Format (csv|json|table|yaml)")
+	return cmd
+}
+
+func (c *cmdPackageManagerList) Run(cmd *cobra.Command, args []string) error {
+	if err := c.global.LoadPackageManagers(); err != nil {
+		return err
+	}
+
+	conf := c.global.conf
+	data := [][]string{}
+	for name, m := range packagemanagers.Managers() {
+		strName := name
+		if name == conf.Get("package_manager") {
+			strName = fmt.Sprintf("%s (%s)", name, "default")
+		}
+		kind := "system"
+		if m.Language {
+			kind = "language"
+		}
+		data = append(data, []string{strName, kind, managerSource(m), orNone(m.Install([]string{"<packages>"}, nil)), orNone(m.Pin.Separator), orNone(m.Repository.Format)})
+	}
+	sort.Sort(utils.ByName(data))
+
+	header := []string{"Name", "Kind", "Source", "Install", "Pin", "Repositories"}
+	return table.RenderTable(c.flagFormat, header, data, packagemanagers.Managers())
+}
+
+func (c *cmdPackageManagerShow) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <name>",
+		Short: "Show the commands of a package manager",
+		Args:  cobra.ExactArgs(1),
+		RunE:  c.Run,
+	}
+
+	cmd.Flags().StringVar(&c.flagFormat, "format", "table", "Format (csv|json|table|yaml)")
+	return cmd
+}
+
+func (c *cmdPackageManagerShow) Run(cmd *cobra.Command, args []string) error {
+	if err := c.global.LoadPackageManagers(); err != nil {
+		return err
+	}
+
+	name := args[0]
+	m := packagemanagers.GetManager(name)
+	if m == nil {
+		return fmt.Errorf("Package manager %s doesn't exist", name)
+	}
+
+	pin, err := m.PinPackage("<package>", "1.0")
+	if err != nil {
+		pin = err.Error()
+	}
+	repository := packagemanagers.Repository{Name: "example", URL: "https://example.com/repo"}
+	addRepository, err := m.AddRepository(repository)
+	if err != nil {
+		addRepository = err.Error()
+	}
+	removeRepository, err := m.RemoveRepository(repository)
+	if err != nil {
+		removeRepository = err.Error()
+	}
+
+	data := [][]string{
+		{"source", managerSource(m)},
+		{"install", orNone(m.Install([]string{"<packages>"}, nil))},
+		{"update", orNone(m.Update())},
+		{"upgrade", orNone(m.Upgrade())},
+		{"remove", orNone(m.Remove([]string{"<packages>"}, nil))},
+		{"clean", orNone(m.Clean())},
+		{"pin", pin},
+		{"installed", orNone(m.IsInstalled("<package>"))},
+		{"installed version", orNone(m.InstalledVersion("<package>"))},
+		{"add repository", addRepository},
+		{"remove repository", removeRepository},
+	}
+	if target, err := m.WithTarget("<target>"); err == nil {
+		data = append(data, []string{"install to a target", target.Install([]string{"<packages>"}, nil)})
+	}
+
+	header := []string{"Operation", "Command"}
+	return table.RenderTable(c.flagFormat, header, data, m)
+}
+
+// managerSource returns the file a package manager is defined in
+func managerSource(m *packagemanagers.Manager) string {
+	if m.Source == "" {
+		return "built-in"
+	}
+	return m.Source
+}
+
+// orNone returns a value, or none when it's empty
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+func init() {
+	packageManagerCmd := cmdPackageManager{global: &globalCmd}
+	packageManagerListCmd := cmdPackageManagerList{global: &globalCmd}
+	packageManagerShowCmd := cmdPackageManagerShow{global: &globalCmd}
+
+	packageManager := packageManagerCmd.Command()
+	packageManager.AddCommand(packageManagerListCmd.Command())
+	packageManager.AddCommand(packageManagerShowCmd.Command())
+
+	rootCmd.AddCommand(packageManager)
+}
@@ -17,6 +17,8 @@ type cmdRemote struct {
 
 type cmdRemoteSet struct {
 	global *cmdGlobal
+
+	flagIdentity string
 }
 
 type cmdRemoteDel struct {
@@ -41,12 +43,15 @@ func (c *cmdRemote) Command() *cobra.Command {
 }
 
 func (c *cmdRemoteSet) Command() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "set <name> <address> <protocol>",
 		Short: "Set a new remote",
 		Args:  cobra.ExactArgs(3),
 		RunE:  c.Run,
 	}
+
+	cmd.Flags().StringVar(&c.flagIdentity, "identity", "", "Identity file used by ssh remotes")
+	return cmd
 }
 
 func (c *cmdRemoteSet) Run(cmd *cobra.Command, args []string) error {
@@ -59,9 +64,14 @@ func (c *cmdRemoteSet) Run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Remote %s already exists", name)
 	}
 
+	if conf.Remotes == nil {
+		conf.Remotes = map[string]config.Remote{}
+	}
+
 	conf.Remotes[name] = config.Remote{
 		Addr:     addr,
 		Protocol: protocol,
+		Identity: c.flagIdentity,
 	}
 
 	return nil
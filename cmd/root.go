@@ -6,6 +6,7 @@ import (
 	"path"
 
 	"github.com/getopendroplet/droplet/config"
+	"github.com/getopendroplet/droplet/packagemanagers"
 	"github.com/getopendroplet/droplet/utils"
 	"github.com/getopendroplet/droplet/utils/stack"
 	"github.com/getopendroplet/droplet/version"
@@ -97,6 +98,31 @@ func (c *cmdGlobal) PreRun(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// LoadPackageManagers loads the package managers and the package aliases
+// defined in the config dir, then the ones defined in the workspace which
+// override them.
+func (c *cmdGlobal) LoadPackageManagers() error {
+	for _, dir := range []string{c.confPath, c.workspacePath} {
+		if err := packagemanagers.LoadManagers(path.Join(os.ExpandEnv(dir), packagemanagers.ManagersDir)); err != nil {
+			return err
+		}
+		if err := packagemanagers.LoadAliases(path.Join(os.ExpandEnv(dir), packagemanagers.AliasFile)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Progress prints a progress message to stderr unless --quiet is set.
+func (c *cmdGlobal) Progress(format string, args ...interface{}) {
+	if c.flagQuiet {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
 func (c *cmdGlobal) PostRun(cmd *cobra.Command, args []string) error {
 	configFile := os.ExpandEnv(path.Join(c.confPath, "config.yml"))
 
@@ -36,25 +36,68 @@ func NewConfig(defaults bool) *Config {
 			"author_email":                    "getopendroplet@gmail.com",
 			"package_manager":                 "apk",
 			"package_manager_action_by_stage": "true",
+			"package_manager_skip_installed":  "true",
 			"builder":                         "local",
+			"cron_scheduler":                  "crontab",
+			"firewall":                        "iptables",
+			"delete_allowed_roots":            "/etc,/home,/opt,/root,/srv,/tmp,/usr/local,/var",
 
 			// builder local commands
-			"builder.local.config":  "awk",
-			"builder.local.copy":    "cp -R",
-			"builder.local.chmod":   "chmod",
-			"builder.local.chown":   "chown",
-			"builder.local.delete":  "rm -rf",
-			"builder.local.env":     "export",
-			"builder.local.expose":  "iptables -A INPUT",
-			"builder.local.label":   "echo",
-			"builder.local.user":    "su",
-			"builder.local.workdir": "cd",
+			"builder.local.addgroup":     "addgroup",
+			"builder.local.adduser":      "adduser",
+			"builder.local.copy":         "cp -R",
+			"builder.local.chmod":        "chmod",
+			"builder.local.chown":        "chown",
+			"builder.local.config":       "mv -f",
+			"builder.local.cron":         "crontab",
+			"builder.local.delete":       "rm -rf",
+			"builder.local.env":          "export",
+			"builder.local.expose":       "iptables -A INPUT",
+			"builder.local.firewall_cmd": "firewall-cmd",
+			"builder.local.groupadd":     "groupadd",
+			"builder.local.ip6tables":    "ip6tables",
+			"builder.local.iptables":     "iptables",
+			"builder.local.label":        "echo",
+			"builder.local.mkdir":        "mkdir -p",
+			"builder.local.nft":          "nft",
+			"builder.local.nft_chain":    "inet filter input",
+			"builder.local.runas":        "runuser",
+			"builder.local.sha256sum":    "sha256sum -c",
+			"builder.local.systemctl":    "systemctl",
+			"builder.local.ufw":          "ufw",
+			"builder.local.units":        "/etc/systemd/system",
+			"builder.local.user":         "su",
+			"builder.local.useradd":      "useradd",
+			"builder.local.workdir":      "cd",
+
+			// builder docker commands
+			"builder.docker.docker": "docker",
+			"builder.docker.image":  "alpine:latest",
+
+			// builder lxd commands
+			"builder.lxd.lxc": "lxc",
+
+			// builder ssh commands
+			"builder.ssh.copy":    "rsync -a",
+			"builder.ssh.port":    "22",
+			"builder.ssh.ssh":     "ssh",
+			"builder.ssh.staging": "/tmp/droplet",
 		}
 	}
 
 	return config
 }
 
+// Get returns the value of a config key, falling back to the default value
+// when the key is missing from a loaded configuration file.
+func (c *Config) Get(key string) string {
+	if value, ok := c.Configs[key]; ok {
+		return value
+	}
+
+	return NewConfig(true).Configs[key]
+}
+
 // LoadConfig reads the configuration from the config file; if the file does
 // not exist, it returns a default configuration.
 func LoadConfig(name string) (*Config, error) {
@@ -70,9 +113,29 @@ func LoadConfig(name string) (*Config, error) {
 		return nil, fmt.Errorf("Unable to decode the configuration: %v", err)
 	}
 
+	c.migrate()
+
 	return c, nil
 }
 
+// legacyConfigs are the former default values of the config keys whose
+// meaning changed, they are replaced by the current default when loading
+var legacyConfigs = map[string][]string{
+	"builder.local.config": {"awk", "cp -R"},
+}
+
+// migrate replaces the legacy values written by former versions.
+func (c *Config) migrate() {
+	defaults := NewConfig(true).Configs
+	for key, values := range legacyConfigs {
+		for _, value := range values {
+			if c.Configs[key] == value {
+				c.Configs[key] = defaults[key]
+			}
+		}
+	}
+}
+
 // SaveConfig writes the provided configuration to the config file.
 func (c *Config) SaveConfig(name string) error {
 	dir, _ := filepath.Split(name)
@@ -4,4 +4,5 @@ package config
 type Remote struct {
 	Addr     string `yaml:"addr"`
 	Protocol string `yaml:"protocol,omitempty"`
+	Identity string `yaml:"identity,omitempty"`
 }
@@ -0,0 +1,304 @@
+// Package buildcontext resolves the files of a build context, the dir the
+// COPY sources are read from.
+package buildcontext
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoreFile lists the files of the build context which are never copied,
+// with the syntax of a .dockerignore file
+const IgnoreFile = ".dropletignore"
+
+// Context - a build context and its ignore patterns
+type Context struct {
+	Dir      string
+	patterns []pattern
+}
+
+var errIgnored = errors.New("ignored file")
+
+type pattern struct {
+	text      string
+	exclusion bool
+	re        *regexp.Regexp
+}
+
+// Load returns the build context of dir, reading its ignore file if any
+func Load(dir string) (*Context, error) {
+	if dir == "" {
+		dir = "."
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid build context %s", dir)
+	}
+	if fi, err := os.Stat(abs); err != nil || !fi.IsDir() {
+		return nil, errors.Errorf("build context %s is not a dir", dir)
+	}
+
+	c := &Context{Dir: abs}
+
+	f, err := os.Open(filepath.Join(abs, IgnoreFile))
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		p := pattern{text: text}
+		if strings.HasPrefix(text, "!") {
+			p.exclusion = true
+			text = strings.TrimSpace(text[1:])
+		}
+		text = path.Clean(strings.TrimPrefix(filepath.ToSlash(text), "/"))
+
+		p.re, err = compilePattern(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s line %d: invalid pattern %s", IgnoreFile, line, p.text)
+		}
+		c.patterns = append(c.patterns, p)
+	}
+
+	return c, scanner.Err()
+}
+
+// compilePattern converts an ignore pattern to a regexp, * and ? don't match
+// a / and ** matches any number of dirs
+func compilePattern(p string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(p); i++ {
+		switch ch := p[i]; ch {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				i++
+				if i+1 < len(p) && p[i+1] == '/' {
+					i++
+					b.WriteString("(.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated [")
+			}
+			class := p[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end
+		case '\\':
+			if i+1 < len(p) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(string(p[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// Ignored returns whether a path of the context, or one of its parent dirs,
+// is matched by the ignore file. The last matching pattern wins, so that a
+// !pattern adds back what a previous pattern ignored.
+func (c *Context) Ignored(rel string) bool {
+	rel = path.Clean(filepath.ToSlash(rel))
+
+	parents := []string{}
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		parents = append(parents, dir)
+	}
+
+	ignored := false
+	for _, p := range c.patterns {
+		if p.exclusion != ignored {
+			continue
+		}
+
+		match := p.re.MatchString(rel)
+		for _, parent := range parents {
+			if match {
+				break
+			}
+			match = p.re.MatchString(parent)
+		}
+		if match {
+			ignored = !p.exclusion
+		}
+	}
+	return ignored
+}
+
+// Glob returns the paths of the context matching a COPY source, relative to
+// the context. Patterns follow filepath.Match, the paths matched by the
+// ignore file are left out.
+func (c *Context) Glob(src string) ([]string, error) {
+	rel, err := c.rel(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.ContainsAny(rel, `*?[\`) {
+		if _, err := os.Lstat(c.Abs(rel)); err != nil || c.Ignored(rel) {
+			return nil, nil
+		}
+		return []string{rel}, nil
+	}
+
+	if _, err := path.Match(rel, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid COPY source %s", src)
+	}
+
+	// Only the dir of the literal prefix of the pattern is walked, down to
+	// the depth of the pattern since * doesn't match a /
+	parts := strings.Split(rel, "/")
+	root := "."
+	for _, part := range parts[:len(parts)-1] {
+		if strings.ContainsAny(part, `*?[\`) {
+			break
+		}
+		root = path.Join(root, part)
+	}
+	if !c.IsDir(root) {
+		return nil, nil
+	}
+
+	matches := []string{}
+	err = filepath.Walk(c.Abs(root), func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(c.Dir, file)
+		if err != nil || name == "." {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		if ok, _ := path.Match(rel, name); ok && !c.Ignored(name) {
+			matches = append(matches, name)
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() && strings.Count(name, "/")+1 >= len(parts) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(matches)
+	return matches, err
+}
+
+// HasIgnored returns whether some files of a dir of the context are ignored
+func (c *Context) HasIgnored(rel string) bool {
+	if len(c.patterns) == 0 {
+		return false
+	}
+
+	err := filepath.Walk(c.Abs(rel), func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(c.Dir, file)
+		if err == nil && c.Ignored(name) {
+			return errIgnored
+		}
+		return err
+	})
+	return err == errIgnored
+}
+
+// Files returns the regular files of a path of the context, the path itself
+// for a file or the files of a dir, relative to the context
+func (c *Context) Files(rel string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(c.Abs(rel), func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(c.Dir, file)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		if c.Ignored(name) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Mode().IsRegular() {
+			files = append(files, name)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Sum returns the hex SHA-256 of a file of the context
+func (c *Context) Sum(rel string) (string, error) {
+	f, err := os.Open(c.Abs(rel))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// IsDir returns whether a path of the context is a dir
+func (c *Context) IsDir(rel string) bool {
+	fi, err := os.Stat(c.Abs(rel))
+	return err == nil && fi.IsDir()
+}
+
+// Abs returns the absolute path of a path of the context
+func (c *Context) Abs(rel string) string {
+	return filepath.Join(c.Dir, filepath.FromSlash(rel))
+}
+
+// rel cleans a source, rejecting the ones outside of the context
+func (c *Context) rel(src string) (string, error) {
+	rel := path.Clean(strings.TrimPrefix(filepath.ToSlash(src), "/"))
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errors.Errorf("COPY source %s is outside of the build context", src)
+	}
+	return rel, nil
+}
@@ -0,0 +1,118 @@
+package buildcontext
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testContext creates a build context holding the files, the dirs are made
+// of the files paths
+func testContext(t *testing.T, files map[string]string) *Context {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "buildcontext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestGlob(t *testing.T) {
+	c := testContext(t, map[string]string{
+		IgnoreFile:           "*.log\nweb/cache\n!keep.log\n",
+		"home.txt":           "home",
+		"hosts":              "hosts",
+		"keep.log":           "keep",
+		"debug.log":          "debug",
+		"web/index.html":     "index",
+		"web/app.js":         "app",
+		"web/cache/page":     "page",
+		"web/static/app.css": "css",
+		"api/index.html":     "api",
+	})
+
+	tests := []struct {
+		src      string
+		expected []string
+	}{
+		{"home.txt", []string{"home.txt"}},
+		{"/home.txt", []string{"home.txt"}},
+		{"missing.txt", nil},
+		{"ho*", []string{"home.txt", "hosts"}},
+		{"*.log", []string{"keep.log"}},
+		{"debug.log", nil},
+		{"web/*.html", []string{"web/index.html"}},
+		{"web/*", []string{"web/app.js", "web/index.html", "web/static"}},
+		{"*/index.html", []string{"api/index.html", "web/index.html"}},
+		{"web/cache/*", nil},
+		{"missing/*", nil},
+		{"web", []string{"web"}},
+	}
+
+	for _, test := range tests {
+		res, err := c.Glob(test.src)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.src, err)
+			continue
+		}
+		if len(res) == 0 && len(test.expected) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.src, test.expected, res)
+		}
+	}
+}
+
+func TestGlobErrors(t *testing.T) {
+	c := testContext(t, map[string]string{"a.txt": "a"})
+
+	for _, src := range []string{"../a.txt", "a/../../b", "[a"} {
+		if _, err := c.Glob(src); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	c := testContext(t, map[string]string{
+		IgnoreFile: "# comment\n**/*.tmp\nbuild\n!build/keep\nsecret?.txt\n",
+	})
+
+	tests := map[string]bool{
+		"a.tmp":          true,
+		"dir/sub/b.tmp":  true,
+		"build":          true,
+		"build/out":      true,
+		"build/keep":     false,
+		"secret1.txt":    true,
+		"secret12.txt":   false,
+		"src/build.go":   false,
+		"src/main.go":    false,
+		"dir/secret1.tx": false,
+	}
+	for name, expected := range tests {
+		if c.Ignored(name) != expected {
+			t.Errorf("%s: expected ignored %v", name, expected)
+		}
+	}
+}
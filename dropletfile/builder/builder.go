@@ -1,63 +1,356 @@
 package builder
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
 
 	"github.com/getopendroplet/droplet/config"
+	"github.com/getopendroplet/droplet/dropletfile/buildcontext"
 	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/dropletfile/parser"
+	"github.com/getopendroplet/droplet/dropletfile/shell"
+	"github.com/getopendroplet/droplet/packagemanagers"
+
+	"github.com/pkg/errors"
 )
 
 // Builder - interface
 type Builder interface {
-	Arg(command instructions.ArgCommand) string
-	Config(command instructions.ConfigCommand) string
-	Copy(command instructions.CopyCommand) string
-	Cron(command instructions.CronCommand) string
-	Delete(command instructions.DeleteCommand) string
-	Env(command instructions.EnvCommand) string
-	Expose(command instructions.ExposeCommand) string
-	Label(command instructions.LabelCommand) string
-	Run(command instructions.RunCommand) string
-	User(command instructions.UserCommand) string
-	Package(command instructions.PackageCommand) string
-	Workdir(command instructions.WorkdirCommand) string
-}
-
-// Build - Dropletfile to script
-func Build(conf *config.Config, commands []instructions.Command) error {
-	b := LocalBuilder{conf: conf}
-
-	for _, c := range commands {
-		fmt.Printf("Building command: %s\n", c.Name())
-		result := ""
+	Arg(command instructions.ArgCommand) (string, error)
+	Config(command instructions.ConfigCommand) (string, error)
+	Copy(command instructions.CopyCommand) (string, error)
+	Cron(command instructions.CronCommand) (string, error)
+	Delete(command instructions.DeleteCommand) (string, error)
+	Env(command instructions.EnvCommand) (string, error)
+	Expose(command instructions.ExposeCommand) (string, error)
+	Label(command instructions.LabelCommand) (string, error)
+	Run(command instructions.RunCommand) (string, error)
+	User(command instructions.UserCommand) (string, error)
+	Package(command instructions.PackageCommand) (string, error)
+	Repository(command instructions.RepositoryCommand) (string, error)
+	Workdir(command instructions.WorkdirCommand) (string, error)
+}
+
+// Finisher is implemented by builders which rework the script once all the
+// instructions are built
+type Finisher interface {
+	Finish(script *Script) error
+}
+
+// Factory creates the Builder used by a build
+type Factory func(conf *config.Config, opts BuildOpts) (Builder, error)
+
+var (
+	builders = map[string]Factory{}
+)
+
+// AddBuilder add builder.
+func AddBuilder(name string, factory Factory) bool {
+	if ExistsBuilder(name) {
+		return false
+	}
+
+	builders[name] = factory
+	return true
+}
+
+// DeleteBuilder delete builder.
+func DeleteBuilder(name string) bool {
+	if !ExistsBuilder(name) {
+		return false
+	}
+
+	delete(builders, name)
+	return true
+}
+
+// ExistsBuilder is builder exists
+func ExistsBuilder(name string) bool {
+	_, ok := builders[name]
+	return ok
+}
+
+// GetBuilder returns the Factory of a builder specified by name.
+func GetBuilder(name string) Factory {
+	if !ExistsBuilder(name) {
+		return nil
+	}
+
+	return builders[name]
+}
+
+// Builders returns the Factory of all builders.
+func Builders() map[string]Factory {
+	return builders
+}
+
+// BuildOpts holds the options of a build
+type BuildOpts struct {
+	Builder     string
+	Dropletfile string
+	ContextDir  string // dir of the files used by COPY and CONFIG
+	EscapeToken rune
+	MetaArgs    []instructions.ArgCommand // ARG instructions preceding the first STAGE
+	BuildArgs   map[string]string         // values overriding the ARG defaults
+	Instance    string
+	Progress    io.Writer
+}
+
+// Build - Dropletfile stages to script, the stages run in the given order
+func Build(conf *config.Config, stages []instructions.Stage, opts BuildOpts) (*Script, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("no build stage given")
+	}
+
+	ctx, err := buildcontext.Load(opts.ContextDir)
+	if err != nil {
+		return nil, err
+	}
+	opts.ContextDir = ctx.Dir
+
+	env := newBuildEnv(shell.NewLex(opts.EscapeToken), opts.BuildArgs)
+	progress := opts.Progress
+	if progress == nil {
+		progress = ioutil.Discard
+	}
+
+	script := &Script{Dropletfile: opts.Dropletfile}
+	calls := []string{}
+	for _, stage := range stages {
+		if len(stages) > 1 {
+			fmt.Fprintf(progress, "Stage %s\n", stage.Name)
+		}
+
+		env.reset()
+		s, err := buildStage(conf, stage, opts, ctx, env, progress)
+		if err != nil {
+			return nil, err
+		}
+
+		script.Stages = append(script.Stages, stage.Name)
+		script.Interpreter = s.Interpreter
+		script.Prologue = s.Prologue
+		script.Warnings = append(script.Warnings, s.Warnings...)
+		script.Manifest = append(script.Manifest, s.Manifest...)
+		if len(stages) == 1 || s.Interpreter == "" {
+			// Outputs which aren't scripts simply chain the stages
+			script.Steps = append(script.Steps, s.Steps...)
+			continue
+		}
+
+		// Every stage runs in a subshell so that the dir, user and variables
+		// of a stage don't leak into the next one
+		var body bytes.Buffer
+		writeSteps(&body, s.Steps)
+		if body.Len() == 0 {
+			// A function body can't be empty
+			body.WriteString("\n:\n")
+		}
+		fn := stageFunc(stage.Name)
+		script.AddStep(stage.SourceCode, fmt.Sprintf("%s() (%s)", fn, body.String()))
+		calls = append(calls, fn)
+	}
+	if len(calls) > 0 {
+		script.AddStep("Run the stages", strings.Join(calls, "\n"))
+	}
+
+	for _, name := range env.unused() {
+		script.Warnings = append(script.Warnings, fmt.Sprintf("[WARNING]: build arg %s was not consumed by an ARG instruction", name))
+	}
+
+	return script, nil
+}
+
+func buildStage(conf *config.Config, stage instructions.Stage, opts BuildOpts, ctx *buildcontext.Context, env *buildEnv, progress io.Writer) (*Script, error) {
+	b, err := newBuilder(conf, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	script := &Script{
+		Dropletfile: opts.Dropletfile,
+		Stages:      []string{stage.Name},
+		Interpreter: "/usr/bin/env bash",
+		Prologue:    []string{"set -euo pipefail"},
+	}
+
+	// Meta args are declared in every stage, copies are expanded so that the
+	// stages don't share them
+	commands := []instructions.Command{}
+	for _, arg := range opts.MetaArgs {
+		metaArg := arg
+		metaArg.Args = append([]instructions.KeyValuePairOptional(nil), arg.Args...)
+		commands = append(commands, &metaArg)
+	}
+	commands = append(commands, stage.Commands...)
+
+	workdir := ""
+	for i, c := range commands {
+		source := ""
+		if s, ok := c.(fmt.Stringer); ok {
+			source = s.String()
+		}
+		fmt.Fprintf(progress, "Step %d/%d : %s\n", i+1, len(commands), source)
+
+		if err := env.apply(c); err != nil {
+			return nil, newBuildError(err, c)
+		}
+		workdir = resolvePaths(workdir, c)
+
+		var result string
+		var err error
 		switch cmd := c.(type) {
 		case *instructions.ArgCommand:
-			result = b.Arg(*cmd)
+			result, err = b.Arg(*cmd)
 		case *instructions.ConfigCommand:
-			result = b.Config(*cmd)
+			cmd.Content, err = renderConfig(opts.ContextDir, cmd.Template(), env.configData(stage.Name))
+			if err == nil {
+				result, err = b.Config(*cmd)
+			}
 		case *instructions.CopyCommand:
-			result = b.Copy(*cmd)
+			var results []string
+			var manifest []ManifestEntry
+			results, manifest, err = buildCopy(conf, b, ctx, *cmd)
+			script.Manifest = append(script.Manifest, manifest...)
+			result = strings.Join(results, "\n")
 		case *instructions.CronCommand:
-			result = b.Cron(*cmd)
+			if cmd.Action == "" {
+				cmd.Action = instructions.CronInstall
+				if stage.Name == instructions.CronRemove {
+					cmd.Action = instructions.CronRemove
+				}
+			}
+			result, err = b.Cron(*cmd)
 		case *instructions.DeleteCommand:
-			result = b.Delete(*cmd)
+			result, err = b.Delete(*cmd)
 		case *instructions.EnvCommand:
-			result = b.Env(*cmd)
+			result, err = b.Env(*cmd)
 		case *instructions.ExposeCommand:
-			result = b.Expose(*cmd)
+			result, err = b.Expose(*cmd)
 		case *instructions.LabelCommand:
-			result = b.Label(*cmd)
+			result, err = b.Label(*cmd)
 		case *instructions.RunCommand:
-			result = b.Run(*cmd)
+			result, err = b.Run(*cmd)
 		case *instructions.UserCommand:
-			result = b.User(*cmd)
+			result, err = b.User(*cmd)
 		case *instructions.PackageCommand:
-			result = b.Package(*cmd)
+			if cmd.Action == "" {
+				cmd.Action = packageAction(conf, stage.Name)
+			}
+			cmd.Map = packageMap(cmd)
+			if err = instructions.ValidatePackageAction(cmd.Action, cmd.Packages); err == nil {
+				result, err = b.Package(*cmd)
+			}
+		case *instructions.RepositoryCommand:
+			if cmd.Action == "" {
+				cmd.Action = instructions.RepositoryAdd
+				if stage.Name == instructions.RepositoryRemove {
+					cmd.Action = instructions.RepositoryRemove
+				}
+			}
+			result, err = b.Repository(*cmd)
 		case *instructions.WorkdirCommand:
-			result = b.Workdir(*cmd)
+			result, err = b.Workdir(*cmd)
+		}
+		if err != nil {
+			return nil, newBuildError(err, c)
+		}
+
+		if result != "" {
+			script.AddStep(source, result)
+		}
+	}
+
+	if f, ok := b.(Finisher); ok {
+		if err := f.Finish(script); err != nil {
+			return nil, err
+		}
+	}
+
+	return script, nil
+}
+
+// packageAction returns the action of a PACKAGE instruction without --action,
+// the stages named install, update and remove set it when
+// package_manager_action_by_stage is true
+func packageAction(conf *config.Config, stage string) string {
+	if conf.Get("package_manager_action_by_stage") == "true" {
+		switch stage {
+		case instructions.PackageInstall, instructions.PackageUpdate, instructions.PackageRemove:
+			return stage
 		}
+	}
+	return instructions.PackageInstall
+}
+
+// packageMap completes the --map of a PACKAGE instruction with the package
+// aliases of the config dir and of the workspace
+func packageMap(cmd *instructions.PackageCommand) instructions.PackageMap {
+	res := instructions.PackageMap{}
+	for _, p := range cmd.Packages {
+		name, _, _ := instructions.SplitPackage(p)
+		for _, aliases := range []map[string]string{packagemanagers.GetAliases(name), cmd.Map[name]} {
+			for manager, alias := range aliases {
+				if res[name] == nil {
+					res[name] = map[string]string{}
+				}
+				res[name][manager] = alias
+			}
+		}
+	}
+	return res
+}
+
+// stageFunc returns the name of the shell function running a stage
+func stageFunc(name string) string {
+	return "stage_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+type buildError struct {
+	inner error
+	line  int
+}
 
-		fmt.Printf("Result: %s\n", result)
+func newBuildError(err error, c instructions.Command) error {
+	line := 0
+	if location := c.Location(); len(location) > 0 {
+		line = location[0].Start.Line
 	}
-	return nil
+	return parser.WithLocation(&buildError{inner: err, line: line}, c.Location())
+}
+
+func (e *buildError) Error() string {
+	return fmt.Sprintf("dropletfile build error line %d: %v", e.line, e.inner.Error())
+}
+
+func (e *buildError) Unwrap() error {
+	return e.inner
+}
+
+func newBuilder(conf *config.Config, opts BuildOpts) (Builder, error) {
+	name := opts.Builder
+	if name == "" {
+		name = conf.Get("builder")
+	}
+
+	factory := GetBuilder(name)
+	if factory == nil {
+		names := []string{}
+		for n := range builders {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, errors.Errorf("unknown builder %s, available builders: %s", name, strings.Join(names, ", "))
+	}
+
+	return factory(conf, opts)
 }
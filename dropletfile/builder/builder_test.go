@@ -0,0 +1,138 @@
+package builder
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getopendroplet/droplet/config"
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/dropletfile/parser"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// testContext is the build context of the tests
+const testContext = "testdata/context"
+
+// testConfig returns the default config with some keys overridden
+func testConfig(configs map[string]string) *config.Config {
+	conf := config.NewConfig(true)
+	for key, value := range configs {
+		conf.Configs[key] = value
+	}
+	return conf
+}
+
+// buildTest builds all the stages of a Dropletfile with the test context
+func buildTest(conf *config.Config, builder string, dropletfile string, buildArgs map[string]string) (*Script, error) {
+	result, err := parser.Parse(strings.NewReader(dropletfile))
+	if err != nil {
+		return nil, err
+	}
+	stages, metaArgs, err := instructions.Parse(result.AST)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, stage := range stages {
+		names = append(names, stage.Name)
+	}
+	stages, err = instructions.ResolveStages(stages, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return Build(conf, stages, BuildOpts{
+		Builder:     builder,
+		Dropletfile: "Dropletfile",
+		ContextDir:  testContext,
+		EscapeToken: result.EscapeToken,
+		MetaArgs:    metaArgs,
+		BuildArgs:   buildArgs,
+		Instance:    "web",
+	})
+}
+
+// buildTestScript builds all the stages of a Dropletfile
+func buildTestScript(t *testing.T, conf *config.Config, builder string, dropletfile string) string {
+	t.Helper()
+
+	script, err := buildTest(conf, builder, dropletfile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := script.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// assertGolden compares the output to testdata/<name>.golden, the golden
+// file is written instead with -update. The path of the test context is
+// replaced by <context>.
+func assertGolden(t *testing.T, name string, output string) {
+	t.Helper()
+
+	abs, err := filepath.Abs(testContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output = strings.Replace(output, abs, "<context>", -1)
+
+	file := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(file, []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(expected) != output {
+		t.Errorf("%s doesn't match the golden file %s, run go test with -update to update it\n%s", name, file, output)
+	}
+}
+
+// assertBashSyntax checks a script with bash -n
+func assertBashSyntax(t *testing.T, script string) {
+	t.Helper()
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	cmd := exec.Command(bash, "-n")
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stderr = &bytes.Buffer{}
+	if err := cmd.Run(); err != nil {
+		t.Errorf("bash -n: %v: %s\n%s", err, cmd.Stderr, script)
+	}
+}
+
+func TestBuildStages(t *testing.T) {
+	dropletfile := `STAGE install
+RUN echo install
+
+STAGE configure --depends=install
+
+STAGE update
+
+STAGE remove
+RUN echo remove
+`
+	script := buildTestScript(t, testConfig(nil), "local", dropletfile)
+	assertGolden(t, "stages", script)
+	assertBashSyntax(t, script)
+}
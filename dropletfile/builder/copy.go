@@ -0,0 +1,173 @@
+package builder
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/getopendroplet/droplet/config"
+	"github.com/getopendroplet/droplet/dropletfile/buildcontext"
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestEntry is the SHA-256 of a file copied by a COPY instruction, at its
+// path on the target
+type ManifestEntry struct {
+	Path   string
+	SHA256 string
+}
+
+func (e ManifestEntry) String() string {
+	return e.SHA256 + "  " + e.Path
+}
+
+// copyGroup is a copy of sources of the build context to a dest
+type copyGroup struct {
+	sources []string
+	dest    string
+}
+
+// buildCopy resolves the sources of a COPY instruction in the build context,
+// and builds a copy for every dest dir followed by the check of the copied
+// files against their SHA-256. Dirs holding ignored files are copied file by
+// file so that the ignored ones are left out.
+func buildCopy(conf *config.Config, b Builder, ctx *buildcontext.Context, command instructions.CopyCommand) ([]string, []ManifestEntry, error) {
+	matches := []string{}
+	seen := map[string]bool{}
+	for _, src := range command.Sources() {
+		res, err := ctx.Glob(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(res) == 0 {
+			return nil, nil, errors.Errorf("COPY source %s not found in the build context %s", src, ctx.Dir)
+		}
+		for _, m := range res {
+			if !seen[m] {
+				seen[m] = true
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	dest := command.Dest()
+	groups := []*copyGroup{}
+	if len(matches) == 1 && !strings.HasSuffix(dest, "/") {
+		if ctx.IsDir(matches[0]) && (matches[0] == "." || ctx.HasIgnored(matches[0])) {
+			groups = copyDir(ctx, groups, matches[0], dest+"/")
+		} else {
+			groups = addToGroup(groups, matches[0], dest)
+		}
+	} else {
+		for _, m := range matches {
+			if ctx.IsDir(m) && (m == "." || ctx.HasIgnored(m)) {
+				groups = copyDir(ctx, groups, m, path.Join(dest, path.Base(m))+"/")
+			} else {
+				groups = addToGroup(groups, m, dest)
+			}
+		}
+	}
+
+	results := []string{}
+	manifest := []ManifestEntry{}
+	for _, g := range groups {
+		entries, err := groupManifest(ctx, g)
+		if err != nil {
+			return nil, nil, err
+		}
+		manifest = append(manifest, entries...)
+
+		sd := instructions.SourcesAndDest{}
+		for _, src := range g.sources {
+			sd = append(sd, ctx.Abs(src))
+		}
+		cp := command
+		cp.SourcesAndDest = append(sd, g.dest)
+
+		result, err := b.Copy(cp)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, result)
+	}
+
+	if len(manifest) > 0 {
+		result, err := b.Run(instructions.RunCommand{
+			ShellDependantCmdLine: instructions.ShellDependantCmdLine{
+				CmdLine:      []string{verifyManifest(conf, manifest)},
+				PrependShell: true,
+			},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, manifest, nil
+}
+
+// copyDir adds the files and dirs of a dir which aren't ignored to the
+// groups, the dirs holding ignored files are walked
+func copyDir(ctx *buildcontext.Context, groups []*copyGroup, dir string, dest string) []*copyGroup {
+	children, _ := ctx.Glob(path.Join(dir, "*"))
+	for _, child := range children {
+		if ctx.IsDir(child) && ctx.HasIgnored(child) {
+			groups = copyDir(ctx, groups, child, path.Join(dest, path.Base(child))+"/")
+		} else {
+			groups = addToGroup(groups, child, dest)
+		}
+	}
+	return groups
+}
+
+func addToGroup(groups []*copyGroup, src string, dest string) []*copyGroup {
+	for _, g := range groups {
+		if g.dest == dest {
+			g.sources = append(g.sources, src)
+			return groups
+		}
+	}
+	return append(groups, &copyGroup{sources: []string{src}, dest: dest})
+}
+
+// groupManifest returns the SHA-256 of the files of a group, at the path the
+// copy writes them to
+func groupManifest(ctx *buildcontext.Context, g *copyGroup) ([]ManifestEntry, error) {
+	intoDir := len(g.sources) > 1 || strings.HasSuffix(g.dest, "/")
+
+	entries := []ManifestEntry{}
+	for _, src := range g.sources {
+		root := g.dest
+		if intoDir {
+			root = path.Join(g.dest, path.Base(src))
+		}
+
+		files, err := ctx.Files(src)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			sum, err := ctx.Sum(file)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, ManifestEntry{
+				Path:   path.Join(root, strings.TrimPrefix(file, src)),
+				SHA256: sum,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// verifyManifest builds the check of the copied files against the manifest
+func verifyManifest(conf *config.Config, manifest []ManifestEntry) string {
+	lines := make([]string, len(manifest))
+	for i, entry := range manifest {
+		lines[i] = entry.String()
+	}
+	return fmt.Sprintf("printf '%%s\\n' %s | %s -", shellJoin(lines), conf.Get("builder.local.sha256sum"))
+}
@@ -0,0 +1,207 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+
+	"github.com/pkg/errors"
+)
+
+// systemdCalendars are the OnCalendar shorthands of the CRON macros
+var systemdCalendars = map[string]string{
+	"@yearly":   "yearly",
+	"@annually": "yearly",
+	"@monthly":  "monthly",
+	"@weekly":   "weekly",
+	"@daily":    "daily",
+	"@midnight": "daily",
+	"@hourly":   "hourly",
+}
+
+var systemdWeekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// cronID identifies a CRON entry by its name, or by its user and command
+func cronID(cmd instructions.CronCommand) string {
+	if cmd.EntryName != "" {
+		return cmd.EntryName
+	}
+	sum := sha256.Sum256([]byte(cmd.User + "\n" + cmdLine(cmd.ShellDependantCmdLine)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// cronMarker is the comment tagging the crontab entry of a CRON instruction
+func cronMarker(cmd instructions.CronCommand) string {
+	return "# droplet-cron:" + cronID(cmd)
+}
+
+// systemdTimer builds the commands installing, or removing, a systemd timer
+// and service running the command of a CRON instruction
+func (l *LocalBuilder) systemdTimer(command instructions.CronCommand) (string, error) {
+	systemctl := l.conf.Get("builder.local.systemctl")
+	unit := "droplet-cron-" + cronID(command)
+	service := path.Join(l.conf.Get("builder.local.units"), unit+".service")
+	timer := path.Join(l.conf.Get("builder.local.units"), unit+".timer")
+
+	if command.Action == instructions.CronRemove {
+		return andThen(
+			fmt.Sprintf("{ %s disable --now %s 2>/dev/null || true; }", systemctl, shellQuote(unit+".timer")),
+			fmt.Sprintf("rm -f %s %s", shellQuote(service), shellQuote(timer)),
+			systemctl+" daemon-reload",
+		), nil
+	}
+
+	trigger := "OnBootSec=0"
+	if command.Macro != "@reboot" {
+		calendar, err := onCalendar(command)
+		if err != nil {
+			return "", err
+		}
+		trigger = "OnCalendar=" + calendar
+	}
+
+	description := "Description=" + strings.Replace(command.String(), "%", "%%", -1)
+	serviceLines := []string{
+		"[Unit]",
+		description,
+		"",
+		"[Service]",
+		"Type=oneshot",
+	}
+	if command.User != "" {
+		serviceLines = append(serviceLines, "User="+command.User)
+	}
+	serviceLines = append(serviceLines, "ExecStart=/bin/sh -c "+systemdQuote(cmdLine(command.ShellDependantCmdLine)))
+
+	timerLines := []string{
+		"[Unit]",
+		description,
+		"",
+		"[Timer]",
+		trigger,
+	}
+	if command.Macro != "@reboot" {
+		timerLines = append(timerLines, "Persistent=true")
+	}
+	timerLines = append(timerLines, "", "[Install]", "WantedBy=timers.target")
+
+	return andThen(
+		fmt.Sprintf("printf '%%s\\n' %s > %s", shellJoin(serviceLines), shellQuote(service)),
+		fmt.Sprintf("printf '%%s\\n' %s > %s", shellJoin(timerLines), shellQuote(timer)),
+		systemctl+" daemon-reload",
+		fmt.Sprintf("%s enable --now %s", systemctl, shellQuote(unit+".timer")),
+	), nil
+}
+
+// onCalendar converts a CRON schedule to a systemd OnCalendar expression
+func onCalendar(cmd instructions.CronCommand) (string, error) {
+	if cmd.Macro != "" {
+		return systemdCalendars[cmd.Macro], nil
+	}
+
+	// cron runs a command matching the day of the month OR the day of the
+	// week, systemd requires both to match
+	if cmd.DayOfTheMonth != "*" && cmd.DayOfTheWeek != "*" {
+		return "", errors.Errorf("CRON schedule %s can't be converted to a systemd timer, it restricts both the day of the month and the day of the week", cmd.Schedule())
+	}
+
+	fields := []struct {
+		value string
+		first int
+		names []string
+	}{
+		{cmd.Minute, 0, nil},
+		{cmd.Hour, 0, nil},
+		{cmd.DayOfTheMonth, 1, nil},
+		{cmd.Month, 1, instructions.CronMonths},
+	}
+	res := make([]string, len(fields))
+	for i, f := range fields {
+		value, err := calendarField(f.value, f.first, f.names)
+		if err != nil {
+			return "", errors.Wrapf(err, "CRON schedule %s can't be converted to a systemd timer", cmd.Schedule())
+		}
+		res[i] = value
+	}
+
+	calendar := fmt.Sprintf("*-%s-%s %s:%s:00", res[3], res[2], res[1], res[0])
+	if cmd.DayOfTheWeek != "*" {
+		weekdays, err := calendarWeekdays(cmd.DayOfTheWeek)
+		if err != nil {
+			return "", errors.Wrapf(err, "CRON schedule %s can't be converted to a systemd timer", cmd.Schedule())
+		}
+		calendar = weekdays + " " + calendar
+	}
+	return calendar, nil
+}
+
+// calendarField converts a cron field to the systemd syntax: 1-5 is 1..5 and
+// */15 is 0/15
+func calendarField(field string, first int, names []string) (string, error) {
+	items := strings.Split(field, ",")
+	for i, item := range items {
+		step := ""
+		if j := strings.Index(item, "/"); j >= 0 {
+			item, step = item[:j], item[j:]
+		}
+
+		if item == "*" {
+			if step != "" {
+				item = strconv.Itoa(first)
+			}
+			items[i] = item + step
+			continue
+		}
+
+		bounds := strings.SplitN(item, "-", 2)
+		if len(bounds) == 2 && step != "" {
+			return "", errors.Errorf("stepped range %s is not supported", field)
+		}
+		for k, bound := range bounds {
+			bounds[k] = calendarValue(bound, first, names)
+		}
+		items[i] = strings.Join(bounds, "..") + step
+	}
+	return strings.Join(items, ","), nil
+}
+
+func calendarValue(value string, first int, names []string) string {
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			return strconv.Itoa(i + first)
+		}
+	}
+	return value
+}
+
+// calendarWeekdays converts a day of the week field to systemd weekday names
+func calendarWeekdays(field string) (string, error) {
+	items := strings.Split(field, ",")
+	for i, item := range items {
+		if strings.Contains(item, "/") || item == "*" {
+			return "", errors.Errorf("day of the week %s is not supported", field)
+		}
+
+		bounds := strings.SplitN(item, "-", 2)
+		for k, bound := range bounds {
+			n, err := strconv.Atoi(calendarValue(bound, 0, instructions.CronWeekdays))
+			if err != nil {
+				return "", errors.Errorf("invalid day of the week %s", bound)
+			}
+			bounds[k] = systemdWeekdays[n]
+		}
+		items[i] = strings.Join(bounds, "..")
+	}
+	return strings.Join(items, ","), nil
+}
+
+// systemdQuote quotes a word for an ExecStart line of a unit file
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`, `$`, `$$`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,57 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCronReplacesOnlyItsEntry(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	dir, err := ioutil.TempDir("", "cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// crontab -l prints the table, crontab - replaces it once read
+	crontab := filepath.Join(dir, "crontab")
+	table := filepath.Join(dir, "table")
+	script := "#!/bin/sh\nif [ \"$1\" = -l ]; then cat " + table + " 2>/dev/null; else t=$(cat); printf '%s\\n' \"$t\" > " + table + "; fi\n"
+	if err := ioutil.WriteFile(crontab, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := testConfig(map[string]string{"builder.local.cron": crontab})
+	run := func(dropletfile string) {
+		t.Helper()
+		cmd := exec.Command(bash, "-c", buildTestScript(t, conf, "local", dropletfile))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+	}
+
+	run(`STAGE install
+CRON --name=backup-db 0 1 * * * backup db
+CRON --name=backup2 0 2 * * * backup two
+CRON --name=backup 0 3 * * * backup
+CRON --name=backup 0 4 * * * backup again
+`)
+	run("STAGE remove\nCRON --name=backup 0 4 * * * backup again\n")
+
+	content, err := ioutil.ReadFile(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "0 1 * * * backup db # droplet-cron:backup-db\n0 2 * * * backup two # droplet-cron:backup2\n"
+	if string(content) != expected {
+		t.Errorf("expected the crontab\n%s\ngot\n%s", expected, strings.TrimSpace(string(content)))
+	}
+}
@@ -0,0 +1,87 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	dropletfile := `STAGE remove
+DELETE /srv/app/cache /var/log/app*
+DELETE --force /etc
+DELETE --dry-run /srv/app/data
+ENV DIR=/srv/app
+DELETE $DIR/tmp
+DELETE --force $HOME/.cache
+`
+	script := buildTestScript(t, testConfig(nil), "local", dropletfile)
+	assertGolden(t, "delete", script)
+	assertBashSyntax(t, script)
+}
+
+func TestDeleteErrors(t *testing.T) {
+	tests := map[string]string{
+		"DELETE /":                   "would remove the root dir",
+		"DELETE /etc":                "removes a system dir, use --force",
+		"DELETE /v*/log":             "matches top-level dirs, use --force",
+		"DELETE ../app":              "is outside of the working dir",
+		"DELETE /boot/grub":          "is outside of the allowed roots",
+		"DELETE --force /boot":       "is outside of the allowed roots",
+		"DELETE $HOME/.cache":        "depends on variables only known on the target, use --force",
+		"WORKDIR /\nDELETE srv":      "removes a system dir, use --force",
+		"DELETE cache":               "is relative without an absolute WORKDIR",
+		"WORKDIR app\nDELETE cache":  "is relative without an absolute WORKDIR",
+		"WORKDIR /boot\nDELETE grub": "is outside of the allowed roots",
+	}
+	for instructions, expected := range tests {
+		_, err := buildTest(testConfig(nil), "local", "STAGE remove\n"+instructions+"\n", nil)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected the error %q, got %v", instructions, expected, err)
+		}
+	}
+}
+
+func TestDeleteRun(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	dir, err := ioutil.TempDir("", "delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"cache/a", "log-1", "log-2", "keep/b"} {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := testConfig(map[string]string{"delete_allowed_roots": dir})
+	dropletfile := "STAGE remove\nWORKDIR " + dir + "\nDELETE cache log-* missing\nDELETE --dry-run keep\n"
+	cmd := exec.Command(bash, "-c", buildTestScript(t, conf, "local", dropletfile))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	if strings.TrimSpace(string(out)) != "droplet: would remove "+filepath.Join(dir, "keep") {
+		t.Errorf("expected the dry run to print the removed path, got %q", out)
+	}
+	left, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || filepath.Base(left[0]) != "keep" {
+		t.Errorf("expected only keep to be left, got %q", left)
+	}
+}
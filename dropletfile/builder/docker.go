@@ -1 +1,419 @@
 package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/getopendroplet/droplet/config"
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/dropletfile/shell"
+
+	"github.com/pkg/errors"
+)
+
+var reDockerSafe = regexp.MustCompile(`^[^\s"'$\\]+$`)
+
+func init() {
+	AddBuilder("docker", func(conf *config.Config, opts BuildOpts) (Builder, error) {
+		return NewDockerExecBuilder(conf)
+	})
+	AddBuilder("dockerfile", func(conf *config.Config, opts BuildOpts) (Builder, error) {
+		return NewDockerfileBuilder(conf, opts)
+	})
+}
+
+// DockerBuilder - build either a Dockerfile, or a script running the
+// commands in an existing container with docker exec and docker cp. Like for
+// the local builder, only RUN and COPY run as the user of the last USER
+// instruction.
+type DockerBuilder struct {
+	LocalBuilder
+	dockerfile bool
+	image      string
+	context    string
+	container  string
+	user       string
+	root       bool // the Dockerfile switched to root for a command
+	workdir    string
+	args       []string
+	env        instructions.KeyValuePairs
+}
+
+// NewDockerfileBuilder returns a DockerBuilder rendering a Dockerfile based
+// on the builder.docker.image config key, for the build context of opts.
+func NewDockerfileBuilder(conf *config.Config, opts BuildOpts) (*DockerBuilder, error) {
+	image := conf.Get("builder.docker.image")
+	if image == "" {
+		return nil, errors.New("no docker image configured, set builder.docker.image")
+	}
+
+	return &DockerBuilder{
+		LocalBuilder: LocalBuilder{conf: conf},
+		dockerfile:   true,
+		image:        image,
+		context:      opts.ContextDir,
+	}, nil
+}
+
+// NewDockerExecBuilder returns a DockerBuilder rendering a script for the
+// running container named by the builder.docker.container config key.
+func NewDockerExecBuilder(conf *config.Config) (*DockerBuilder, error) {
+	container := conf.Get("builder.docker.container")
+	if container == "" {
+		return nil, errors.New("no docker container configured, set builder.docker.container")
+	}
+
+	return &DockerBuilder{
+		LocalBuilder: LocalBuilder{conf: conf},
+		container:    container,
+	}, nil
+}
+
+// Arg - build docker arg command
+func (d *DockerBuilder) Arg(command instructions.ArgCommand) (string, error) {
+	if d.dockerfile {
+		args := []string{}
+		for _, arg := range command.Args {
+			if arg.Value == nil {
+				args = append(args, arg.Key)
+			} else {
+				args = append(args, arg.Key+"="+dockerQuote(*arg.Value))
+			}
+		}
+		return "ARG " + strings.Join(args, " "), nil
+	}
+
+	// Args are set in the script and passed to every docker exec
+	for _, arg := range command.Args {
+		d.args = append(d.args, arg.Key)
+	}
+	return d.LocalBuilder.Arg(command)
+}
+
+// Config - build docker config command
+func (d *DockerBuilder) Config(command instructions.ConfigCommand) (string, error) {
+	return d.wrap(d.LocalBuilder.Config(command))
+}
+
+// Copy - build docker copy command
+func (d *DockerBuilder) Copy(command instructions.CopyCommand) (string, error) {
+	return d.copy(command.SourcesAndDest, command.Chown, command.Chmod)
+}
+
+// Cron - build docker cron command
+func (d *DockerBuilder) Cron(command instructions.CronCommand) (string, error) {
+	return d.wrap(d.LocalBuilder.Cron(command))
+}
+
+// Delete - build docker delete command
+func (d *DockerBuilder) Delete(command instructions.DeleteCommand) (string, error) {
+	return d.wrap(d.LocalBuilder.Delete(command))
+}
+
+// Env - build docker env command
+func (d *DockerBuilder) Env(command instructions.EnvCommand) (string, error) {
+	if d.dockerfile {
+		return "ENV " + dockerKvps(command.Env), nil
+	}
+
+	d.env = append(d.env, command.Env...)
+	return "", nil
+}
+
+// Expose - build docker expose command
+func (d *DockerBuilder) Expose(command instructions.ExposeCommand) (string, error) {
+	specs, err := command.PortSpecs()
+	if err != nil {
+		return "", err
+	}
+	ports := make([]string, len(specs))
+	for i, spec := range specs {
+		ports[i] = spec.String()
+	}
+
+	if d.dockerfile {
+		return "EXPOSE " + strings.Join(ports, " "), nil
+	}
+
+	// Ports can only be published when a container is created
+	msg := fmt.Sprintf("droplet: publish %s when creating the container %s", strings.Join(ports, " "), d.container)
+	return fmt.Sprintf("echo %s >&2", shellQuote(msg)), nil
+}
+
+// Label - build docker label command
+func (d *DockerBuilder) Label(command instructions.LabelCommand) (string, error) {
+	if d.dockerfile {
+		return "LABEL " + dockerKvps(command.Labels), nil
+	}
+
+	return d.LocalBuilder.Label(command)
+}
+
+// Run - build docker run command
+func (d *DockerBuilder) Run(command instructions.RunCommand) (string, error) {
+	if command.PrependShell {
+		cmd, err := d.LocalBuilder.Run(command)
+		if err != nil {
+			return "", err
+		}
+		if d.dockerfile {
+			return d.switchBack("RUN " + cmd), nil
+		}
+		return d.execAs("sh -c " + shellQuote(cmd)), nil
+	}
+
+	if d.dockerfile {
+		return d.switchBack("RUN " + dockerJSON(command.CmdLine)), nil
+	}
+	return d.execAs(shellJoin(command.CmdLine)), nil
+}
+
+// User - build docker user command, the user is created as root
+func (d *DockerBuilder) User(command instructions.UserCommand) (string, error) {
+	cmd := []string{}
+	if command.Create {
+		create, _ := d.wrap(d.LocalBuilder.createUser(command), nil)
+		cmd = append(cmd, create)
+	}
+
+	d.user, d.root = "", false
+	if !command.IsRoot() {
+		d.user = command.User
+	}
+	if d.dockerfile {
+		return strings.Join(append(cmd, "USER "+dockerQuote(command.User)), "\n"), nil
+	}
+	return andThen(cmd...), nil
+}
+
+// Package - build docker package command
+func (d *DockerBuilder) Package(command instructions.PackageCommand) (string, error) {
+	return d.wrap(d.LocalBuilder.Package(command))
+}
+
+// Repository - build docker repository command
+func (d *DockerBuilder) Repository(command instructions.RepositoryCommand) (string, error) {
+	return d.wrap(d.LocalBuilder.Repository(command))
+}
+
+// Workdir - build docker workdir command
+func (d *DockerBuilder) Workdir(command instructions.WorkdirCommand) (string, error) {
+	if d.dockerfile {
+		return "WORKDIR " + dockerQuote(command.Path), nil
+	}
+
+	// Relative dirs are relative to the root until an absolute WORKDIR
+	workdir := path.Join("/", command.Resolved)
+	// The dir is created before docker exec is told to use it
+	cmd := d.exec(fmt.Sprintf("%s %s", d.conf.Get("builder.local.mkdir"), shellQuote(workdir)))
+	d.workdir = workdir
+	return cmd, nil
+}
+
+func (d *DockerBuilder) copy(sd instructions.SourcesAndDest, chown string, chmod string) (string, error) {
+	if d.dockerfile {
+		cmd := []string{"COPY"}
+		if chown != "" {
+			cmd = append(cmd, "--chown="+chown)
+		}
+		if chmod != "" {
+			cmd = append(cmd, "--chmod="+chmod)
+		}
+		return d.dockerfileCopy(cmd, sd)
+	}
+
+	docker := d.conf.Get("builder.docker.docker")
+	dest := sd.Dest()
+	if !path.IsAbs(dest) {
+		// docker cp resolves relative paths against the root of the container
+		isDir := strings.HasSuffix(dest, "/")
+		dest = path.Join("/", d.workdir, dest)
+		if isDir {
+			dest += "/"
+		}
+	}
+
+	// docker cp takes a single source and needs an existing destination dir
+	dir := dest
+	if len(sd.Sources()) == 1 && !strings.HasSuffix(dest, "/") {
+		dir = path.Dir(dest)
+	}
+	cmd := []string{
+		d.exec(fmt.Sprintf("%s %s", d.conf.Get("builder.local.mkdir"), shellQuote(dir))),
+		fmt.Sprintf("for src in %s; do %s cp \"$src\" %s; done", shellJoinGlob(sd.Sources()), docker, shellQuote(d.container+":"+dest)),
+	}
+	if chown == "" {
+		// docker cp copies as root, the files are owned by the user of the
+		// last USER instruction
+		chown = d.user
+	}
+
+	targets := []string{dest}
+	if len(sd.Sources()) > 1 || strings.HasSuffix(dest, "/") {
+		targets = make([]string, len(sd.Sources()))
+		for i, src := range sd.Sources() {
+			targets[i] = path.Join(dest, path.Base(src))
+		}
+	}
+	if chown != "" {
+		cmd = append(cmd, d.exec("sh -c "+shellQuote(fmt.Sprintf("%s -R %s %s", d.conf.Get("builder.local.chown"), shellQuote(chown), shellJoinGlob(targets)))))
+	}
+	if chmod != "" {
+		cmd = append(cmd, d.exec("sh -c "+shellQuote(fmt.Sprintf("%s -R %s %s", d.conf.Get("builder.local.chmod"), shellQuote(chmod), shellJoinGlob(targets)))))
+	}
+	return andThen(cmd...), nil
+}
+
+// dockerfileCopy renders COPY instructions with sources relative to the build
+// context. Docker copies the content of a dir, so a dir copied into a dir is
+// copied to a dir of the same name like cp -R does.
+func (d *DockerBuilder) dockerfileCopy(flags []string, sd instructions.SourcesAndDest) (string, error) {
+	dest := sd.Dest()
+	intoDir := len(sd.Sources()) > 1 || strings.HasSuffix(dest, "/")
+
+	lines := []string{}
+	files := []string{}
+	for _, src := range sd.Sources() {
+		rel := src
+		if d.context != "" && filepath.IsAbs(src) {
+			var err error
+			if rel, err = filepath.Rel(d.context, src); err != nil {
+				return "", err
+			}
+			rel = filepath.ToSlash(rel)
+		}
+
+		if fi, err := os.Stat(src); err == nil && fi.IsDir() && intoDir {
+			lines = append(lines, dockerCopy(flags, []string{rel, path.Join(dest, path.Base(rel)) + "/"}))
+			continue
+		}
+		files = append(files, rel)
+	}
+	if len(files) > 0 {
+		lines = append([]string{dockerCopy(flags, append(files, dest))}, lines...)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// dockerCopy renders a COPY instruction, in the JSON form when a path needs
+// quoting
+func dockerCopy(flags []string, sd []string) string {
+	for i := range sd {
+		sd[i] = shell.Source(sd[i])
+	}
+	for _, p := range sd {
+		if !reDockerSafe.MatchString(p) {
+			return strings.Join(append(flags, dockerJSON(sd)), " ")
+		}
+	}
+	return strings.Join(append(flags, sd...), " ")
+}
+
+// wrap turns a shell command into a RUN instruction or a docker exec run as
+// root. A Dockerfile switches to root until the next RUN.
+func (d *DockerBuilder) wrap(cmd string, err error) (string, error) {
+	if err != nil || cmd == "" {
+		return cmd, err
+	}
+	if d.dockerfile {
+		if d.user == "" || d.root {
+			return "RUN " + cmd, nil
+		}
+		d.root = true
+		return "USER root\nRUN " + cmd, nil
+	}
+	return d.exec("sh -c " + shellQuote(cmd)), nil
+}
+
+// switchBack prepends the switch back to the user of the last USER
+// instruction to a Dockerfile instruction, when a command switched to root
+func (d *DockerBuilder) switchBack(cmd string) string {
+	if !d.root {
+		return cmd
+	}
+	d.root = false
+	return "USER " + dockerQuote(d.user) + "\n" + cmd
+}
+
+// exec returns a docker exec of cmd run as root with the current workdir and
+// env
+func (d *DockerBuilder) exec(cmd string) string {
+	return d.dockerExec(cmd, "")
+}
+
+// execAs returns a docker exec of cmd run as the user of the last USER
+// instruction
+func (d *DockerBuilder) execAs(cmd string) string {
+	return d.dockerExec(cmd, d.user)
+}
+
+// dockerExec passes the args with their value in the script, the env is
+// exported in the container so that it refers to the variables set there
+func (d *DockerBuilder) dockerExec(cmd string, user string) string {
+	args := []string{d.conf.Get("builder.docker.docker"), "exec"}
+	if user != "" {
+		args = append(args, "--user", shellQuote(user))
+	}
+	if d.workdir != "" {
+		args = append(args, "--workdir", shellQuote(d.workdir))
+	}
+	for _, arg := range d.args {
+		args = append(args, "--env", fmt.Sprintf("%s=\"$%s\"", arg, arg))
+	}
+
+	cmd = exportEnv(d.conf.Get("builder.local.env"), d.env, cmd)
+	return strings.Join(append(args, shellQuote(d.container), cmd), " ")
+}
+
+// Finish turns the script into a Dockerfile
+func (d *DockerBuilder) Finish(script *Script) error {
+	if !d.dockerfile {
+		return nil
+	}
+
+	script.Interpreter = ""
+	script.Prologue = []string{"FROM " + d.image}
+	if d.root {
+		// The image runs as the user of the last USER instruction
+		script.AddStep("", "USER "+dockerQuote(d.user))
+	}
+	return nil
+}
+
+// dockerQuote quotes a word for a Dockerfile, the variables left for the
+// target are expanded by docker
+func dockerQuote(s string) string {
+	if reDockerSafe.MatchString(s) && !shell.HasRefs(s) {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	parts := shell.SplitRefs(s)
+	for i := range parts {
+		if i%2 == 1 {
+			parts[i] = "${" + parts[i] + "}"
+		} else {
+			parts[i] = r.Replace(parts[i])
+		}
+	}
+	return `"` + strings.Join(parts, "") + `"`
+}
+
+// dockerKvps renders key=value pairs for ENV and LABEL instructions
+func dockerKvps(kvps instructions.KeyValuePairs) string {
+	res := make([]string, len(kvps))
+	for i, kvp := range kvps {
+		res[i] = dockerQuote(kvp.Key) + "=" + dockerQuote(kvp.Value)
+	}
+	return strings.Join(res, " ")
+}
+
+// dockerJSON renders the exec form of an instruction
+func dockerJSON(args []string) string {
+	b, _ := json.Marshal(args)
+	return strings.Replace(string(b), `","`, `", "`, -1)
+}
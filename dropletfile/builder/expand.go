@@ -0,0 +1,173 @@
+package builder
+
+import (
+	"sort"
+
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/dropletfile/shell"
+
+	"github.com/pkg/errors"
+)
+
+// buildEnv holds the variables declared by ARG and ENV instructions, and
+// expands the words of the following instructions with them. The variables
+// which aren't declared are expanded by the shell running the script.
+type buildEnv struct {
+	lex       *shell.Lex
+	buildArgs map[string]string
+	used      map[string]bool
+	required  map[string]bool
+	args      map[string]string
+	env       map[string]string
+	labels    map[string]string
+}
+
+func newBuildEnv(lex *shell.Lex, buildArgs map[string]string) *buildEnv {
+	return &buildEnv{
+		lex:       lex,
+		buildArgs: buildArgs,
+		used:      map[string]bool{},
+		required:  map[string]bool{},
+		args:      map[string]string{},
+		env:       map[string]string{},
+		labels:    map[string]string{},
+	}
+}
+
+// reset forgets the variables declared so far, the build args consumed are
+// kept since they are reported for the whole build
+func (e *buildEnv) reset() {
+	e.required = map[string]bool{}
+	e.args = map[string]string{}
+	e.env = map[string]string{}
+	e.labels = map[string]string{}
+}
+
+// lookup returns the value of a variable, ENV always overrides ARG
+func (e *buildEnv) lookup(name string) (string, bool) {
+	if value, ok := e.env[name]; ok {
+		return value, true
+	}
+	value, ok := e.args[name]
+	return value, ok
+}
+
+func (e *buildEnv) expand(word string) (string, error) {
+	return e.lex.ProcessWord(word, e.lookup, e.unset)
+}
+
+// unset returns a reference to a variable which isn't declared, it is left
+// for the shell running the script. Required build args without a value fail.
+func (e *buildEnv) unset(name string) (string, error) {
+	if e.required[name] {
+		return "", errors.Errorf("build arg %s is required, set it with --build-arg %s=<value>", name, name)
+	}
+	return shell.Ref(name), nil
+}
+
+// apply expands the variables of a command, then records the variables it
+// declares.
+func (e *buildEnv) apply(c instructions.Command) error {
+	if ex, ok := c.(instructions.SupportsSingleWordExpansion); ok {
+		if err := ex.Expand(e.expand); err != nil {
+			return err
+		}
+	}
+	for _, word := range buildTimeWords(c) {
+		if shell.HasRefs(word) {
+			return errors.Errorf("undefined variable %s in %q, declare it with ARG or ENV", shell.SplitRefs(word)[1], shell.Source(word))
+		}
+	}
+
+	switch cmd := c.(type) {
+	case *instructions.ArgCommand:
+		for i, arg := range cmd.Args {
+			if value, ok := e.buildArgs[arg.Key]; ok {
+				e.used[arg.Key] = true
+				cmd.Args[i].Value = &value
+			}
+
+			if cmd.Args[i].Value == nil {
+				e.required[arg.Key] = true
+				delete(e.args, arg.Key)
+				continue
+			}
+			delete(e.required, arg.Key)
+			e.args[arg.Key] = *cmd.Args[i].Value
+		}
+	case *instructions.EnvCommand:
+		for _, env := range cmd.Env {
+			e.env[env.Key] = env.Value
+		}
+	case *instructions.LabelCommand:
+		for _, label := range cmd.Labels {
+			e.labels[label.Key] = label.Value
+		}
+	}
+
+	return nil
+}
+
+// buildTimeWords returns the words of a command which are used while building
+// the script, they can't reference the variables left for the target
+func buildTimeWords(c instructions.Command) []string {
+	switch cmd := c.(type) {
+	case *instructions.ArgCommand:
+		words := []string{}
+		for _, arg := range cmd.Args {
+			words = append(words, arg.Key)
+		}
+		return words
+	case *instructions.ConfigCommand:
+		return []string{cmd.Template()}
+	case *instructions.CopyCommand:
+		return cmd.Sources()
+	case *instructions.CronCommand:
+		return []string{cmd.User, cmd.EntryName, cmd.Action}
+	case *instructions.EnvCommand:
+		words := []string{}
+		for _, env := range cmd.Env {
+			words = append(words, env.Key)
+		}
+		return words
+	case *instructions.ExposeCommand:
+		return append([]string{cmd.From}, cmd.Ports...)
+	case *instructions.PackageCommand:
+		return append([]string{cmd.Action, cmd.Manager, cmd.Target}, cmd.Packages...)
+	case *instructions.RepositoryCommand:
+		return append([]string{cmd.URL, cmd.RepositoryName, cmd.Key, cmd.Suite, cmd.Action}, cmd.Components...)
+	}
+	return nil
+}
+
+// configData returns the values declared so far for CONFIG templates
+func (e *buildEnv) configData(stage string) ConfigData {
+	data := ConfigData{
+		Stage:  stage,
+		Args:   map[string]string{},
+		Env:    map[string]string{},
+		Labels: map[string]string{},
+	}
+	for k, v := range e.args {
+		data.Args[k] = shell.Source(v)
+	}
+	for k, v := range e.env {
+		data.Env[k] = shell.Source(v)
+	}
+	for k, v := range e.labels {
+		data.Labels[k] = shell.Source(v)
+	}
+	return data
+}
+
+// unused returns the build args which weren't declared by an ARG
+func (e *buildEnv) unused() []string {
+	res := []string{}
+	for name := range e.buildArgs {
+		if !e.used[name] {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,52 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandTargetVariables(t *testing.T) {
+	dropletfile := `STAGE install
+ARG version=1.0
+ENV PATH=/opt/bin:$PATH APP="$HOME/my app" LITERAL='$HOME' VERSION=v$version
+WORKDIR $APP
+USER ${DEPLOY_USER:-deploy}
+`
+	script := buildTestScript(t, testConfig(nil), "local", dropletfile)
+
+	for _, expected := range []string{
+		`export PATH=/opt/bin:"${PATH-}" APP="${HOME-}"'/my app' LITERAL='$HOME' VERSION=v1.0`,
+		`cd "${HOME-}"'/my app'`,
+		`id -u deploy >/dev/null`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected %s in\n%s", expected, script)
+		}
+	}
+	assertBashSyntax(t, script)
+}
+
+func TestExpandErrors(t *testing.T) {
+	tests := []struct {
+		dropletfile string
+		err         string
+	}{
+		{"STAGE install\nARG version\nENV VERSION=$version\n", "build arg version is required"},
+		{"STAGE install\nCOPY $HOME/a.txt /srv/\n", "undefined variable HOME"},
+		{"STAGE install\nENV SRC=$HOME\nCOPY $SRC /srv/\n", "undefined variable HOME"},
+		{"STAGE install\nPACKAGE $PKG\n", "undefined variable PKG"},
+		{"STAGE install\nDELETE $HOME/cache\n", "use --force"},
+	}
+
+	for _, test := range tests {
+		_, err := buildTest(testConfig(nil), "local", test.dropletfile, nil)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected an error with %q, got %v", test.dropletfile, test.err, err)
+		}
+	}
+
+	dropletfile := "STAGE install\nARG version\nENV VERSION=$version\n"
+	if _, err := buildTest(testConfig(nil), "local", dropletfile, map[string]string{"version": "1.0"}); err != nil {
+		t.Errorf("unexpected error with --build-arg: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getopendroplet/droplet/config"
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+
+	"github.com/pkg/errors"
+)
+
+// firewall renders the commands allowing the ports of an EXPOSE instruction,
+// every rule is checked before being added so that running the script again
+// doesn't duplicate it
+type firewall struct {
+	allow  func(conf *config.Config, spec instructions.PortSpec) string
+	reload func(conf *config.Config) string
+}
+
+var firewalls = map[string]firewall{
+	"iptables":  {allow: iptablesAllow},
+	"nftables":  {allow: nftablesAllow},
+	"ufw":       {allow: ufwAllow},
+	"firewalld": {allow: firewalldAllow, reload: firewalldReload},
+}
+
+// getFirewall returns the firewall backend set in the config
+func getFirewall(conf *config.Config) (firewall, error) {
+	name := conf.Get("firewall")
+	fw, ok := firewalls[name]
+	if !ok {
+		names := make([]string, 0, len(firewalls))
+		for n := range firewalls {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fw, errors.Errorf("unknown firewall %s, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return fw, nil
+}
+
+// iptablesAllow appends the IPv4 rules with builder.local.expose
+func iptablesAllow(conf *config.Config, spec instructions.PortSpec) string {
+	iptables := conf.Get("builder.local.iptables")
+	add := conf.Get("builder.local.expose")
+	if spec.IPv6() {
+		iptables = conf.Get("builder.local.ip6tables")
+		add = iptables + " -A INPUT"
+	}
+
+	rule := fmt.Sprintf("-p %s --dport %s", spec.Protocol, spec.Ports(":"))
+	if spec.Source != "" {
+		rule += " -s " + shellQuote(spec.Source)
+	}
+	rule += " -j ACCEPT"
+
+	return fmt.Sprintf("{ %s -C INPUT %s 2>/dev/null || %s %s; }", iptables, rule, add, rule)
+}
+
+// nftablesAllow tags the rule with a comment, nft can't check a rule exists
+func nftablesAllow(conf *config.Config, spec instructions.PortSpec) string {
+	nft := conf.Get("builder.local.nft")
+	chain := conf.Get("builder.local.nft_chain")
+	comment := "droplet:" + spec.String()
+
+	rule := ""
+	if spec.Source != "" {
+		family := "ip"
+		if spec.IPv6() {
+			family = "ip6"
+		}
+		rule = fmt.Sprintf("%s saddr %s ", family, shellQuote(spec.Source))
+		comment += ":" + spec.Source
+	}
+	rule += fmt.Sprintf("%s dport %s accept comment %s", spec.Protocol, spec.Ports("-"), shellQuote(`"`+comment+`"`))
+
+	return fmt.Sprintf("{ %s list chain %s | grep -q -F %s || %s add rule %s %s; }",
+		nft, chain, shellQuote(`comment "`+comment+`"`), nft, chain, rule)
+}
+
+// ufwAllow relies on ufw, which skips the rules it already has
+func ufwAllow(conf *config.Config, spec instructions.PortSpec) string {
+	ufw := conf.Get("builder.local.ufw")
+	if spec.Source == "" {
+		return fmt.Sprintf("%s allow %s/%s", ufw, spec.Ports(":"), spec.Protocol)
+	}
+	return fmt.Sprintf("%s allow from %s to any port %s proto %s", ufw, shellQuote(spec.Source), spec.Ports(":"), spec.Protocol)
+}
+
+// firewalldAllow adds permanent rules, they are applied by firewalldReload
+func firewalldAllow(conf *config.Config, spec instructions.PortSpec) string {
+	cmd := conf.Get("builder.local.firewall_cmd") + " --permanent"
+	if spec.Source == "" {
+		port := shellQuote(spec.String())
+		return fmt.Sprintf("{ %s --query-port=%s >/dev/null || %s --add-port=%s; }", cmd, port, cmd, port)
+	}
+
+	family := "ipv4"
+	if spec.IPv6() {
+		family = "ipv6"
+	}
+	rule := shellQuote(fmt.Sprintf(`rule family="%s" source address="%s" port port="%s" protocol="%s" accept`,
+		family, spec.Source, spec.Ports("-"), spec.Protocol))
+	return fmt.Sprintf("{ %s --query-rich-rule=%s >/dev/null || %s --add-rich-rule=%s; }", cmd, rule, cmd, rule)
+}
+
+func firewalldReload(conf *config.Config) string {
+	return conf.Get("builder.local.firewall_cmd") + " --reload"
+}
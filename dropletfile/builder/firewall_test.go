@@ -0,0 +1,39 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+// firewallDropletfile exposes single ports, ranges and ports restricted to
+// IPv4 and IPv6 sources
+const firewallDropletfile = `STAGE install
+EXPOSE 80 443/tcp 60000-60010/udp
+EXPOSE --from=10.0.0.0/8 5432
+EXPOSE --from=2001:db8::/32 53/udp
+`
+
+func TestFirewalls(t *testing.T) {
+	for _, name := range []string{"iptables", "nftables", "ufw", "firewalld"} {
+		t.Run(name, func(t *testing.T) {
+			script := buildTestScript(t, testConfig(map[string]string{"firewall": name}), "local", firewallDropletfile)
+			assertGolden(t, "firewall-"+name, script)
+			assertBashSyntax(t, script)
+		})
+	}
+}
+
+func TestFirewallErrors(t *testing.T) {
+	tests := map[string]string{
+		"STAGE install\nEXPOSE 80\n":                    "unknown firewall pf, expected one of firewalld, iptables, nftables, ufw",
+		"STAGE install\nEXPOSE 70000\n":                 "invalid EXPOSE port",
+		"STAGE install\nEXPOSE --from=example.com 80\n": "invalid EXPOSE source",
+	}
+	conf := testConfig(map[string]string{"firewall": "pf"})
+	for dropletfile, expected := range tests {
+		_, err := buildTest(conf, "local", dropletfile, nil)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected the error %q, got %v", dropletfile, expected, err)
+		}
+	}
+}
@@ -1,80 +1,295 @@
 package builder
 
 import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"regexp"
 	"strings"
 
 	"github.com/getopendroplet/droplet/config"
 	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/dropletfile/shell"
+	"github.com/getopendroplet/droplet/packagemanagers"
+
+	"github.com/pkg/errors"
 )
 
-// LocalBuilder - build local commands
+// configBackupSuffix is appended to the name of the backup of a config file
+const configBackupSuffix = ".droplet-bak"
+
+func init() {
+	AddBuilder("local", func(conf *config.Config, opts BuildOpts) (Builder, error) {
+		return &LocalBuilder{conf: conf}, nil
+	})
+}
+
+// LocalBuilder - build local commands, RUN and COPY run as the user of the
+// last USER instruction
 type LocalBuilder struct {
-	conf *config.Config
+	conf  *config.Config
+	user  string
+	group string
 }
 
 // Arg - build local arg command
-func (l LocalBuilder) Arg(command instructions.ArgCommand) string {
-	return ""
+func (l *LocalBuilder) Arg(command instructions.ArgCommand) (string, error) {
+	// The args are exported so that RUN sees them once run as the USER
+	cmd := []string{l.conf.Get("builder.local.env")}
+	for _, arg := range command.Args {
+		if arg.Value == nil {
+			// Required args without a value are read from the environment
+			cmd = append(cmd, fmt.Sprintf("%s=${%s-}", arg.Key, arg.Key))
+			continue
+		}
+		cmd = append(cmd, arg.Key+"="+shellQuote(*arg.Value))
+	}
+	return strings.Join(cmd, " "), nil
 }
 
-// Config - build local config command
-func (l LocalBuilder) Config(command instructions.ConfigCommand) string {
-	return ""
+// Config - build local config command, the rendered template is written to
+// a temp file next to the destination, then renamed over it. The previous
+// version is kept with the configBackupSuffix.
+func (l *LocalBuilder) Config(command instructions.ConfigCommand) (string, error) {
+	dest := command.Dest()
+	if strings.HasSuffix(dest, "/") {
+		dest = path.Join(dest, strings.TrimSuffix(path.Base(command.Template()), ".tmpl"))
+	}
+	mode := command.Mode
+	if mode == "" {
+		mode = "0644"
+	}
+
+	cmd := []string{
+		l.mkdir(dest, false),
+		fmt.Sprintf(`DROPLET_TMP="$(mktemp %s)"`, shellQuote(path.Join(path.Dir(dest), "."+path.Base(dest)+".XXXXXX"))),
+		fmt.Sprintf(`echo %s | base64 -d > "$DROPLET_TMP"`, base64.StdEncoding.EncodeToString(command.Content)),
+		fmt.Sprintf(`%s %s "$DROPLET_TMP"`, l.conf.Get("builder.local.chmod"), shellQuote(mode)),
+	}
+	if command.Owner != "" {
+		cmd = append(cmd, fmt.Sprintf(`%s %s "$DROPLET_TMP"`, l.conf.Get("builder.local.chown"), shellQuote(command.Owner)))
+	}
+	cmd = append(cmd,
+		fmt.Sprintf("{ [ ! -e %s ] || cp -p %s %s; }", shellQuote(dest), shellQuote(dest), shellQuote(dest+configBackupSuffix)),
+		fmt.Sprintf(`%s "$DROPLET_TMP" %s`, l.conf.Get("builder.local.config"), shellQuote(dest)),
+	)
+	return andThen(cmd...), nil
 }
 
 // Copy - build local copy command
-func (l LocalBuilder) Copy(command instructions.CopyCommand) string {
-	cmd := []string{l.conf.Configs["builder.local.copy"]}
-	return strings.Join(cmd, " ")
+func (l *LocalBuilder) Copy(command instructions.CopyCommand) (string, error) {
+	sources := command.Sources()
+	dest := command.Dest()
+
+	// Permissions only apply to the copied files, not to an existing destination dir
+	targets := []string{dest}
+	if len(sources) > 1 || strings.HasSuffix(dest, "/") {
+		targets = make([]string, len(sources))
+		for i, src := range sources {
+			targets[i] = path.Join(dest, path.Base(src))
+		}
+	}
+
+	// The files are copied as root, the USER may not read the sources nor
+	// write to the destination, then they're owned by the USER
+	cmd := []string{
+		l.mkdir(dest, len(sources) > 1),
+		fmt.Sprintf("%s %s %s", l.conf.Get("builder.local.copy"), shellJoinGlob(sources), shellQuote(dest)),
+	}
+	if chown := l.owner(command.Chown); chown != "" {
+		cmd = append(cmd, fmt.Sprintf("%s -R %s %s", l.conf.Get("builder.local.chown"), shellQuote(chown), shellJoinGlob(targets)))
+	}
+	if command.Chmod != "" {
+		cmd = append(cmd, fmt.Sprintf("%s -R %s %s", l.conf.Get("builder.local.chmod"), shellQuote(command.Chmod), shellJoinGlob(targets)))
+	}
+	return andThen(cmd...), nil
 }
 
-// Cron - build local cron command
-func (l LocalBuilder) Cron(command instructions.CronCommand) string {
-	return ""
+// Cron - build local cron command, the entry replaces the one with the same
+// marker so that running the script again doesn't duplicate it
+func (l *LocalBuilder) Cron(command instructions.CronCommand) (string, error) {
+	if l.conf.Get("cron_scheduler") == "systemd" {
+		return l.systemdTimer(command)
+	}
+
+	crontab := l.conf.Get("builder.local.cron")
+	if command.User != "" {
+		crontab += " -u " + shellQuote(command.User)
+	}
+
+	// The marker ends the entry, a marker made of the same name followed by
+	// more chars belongs to another entry
+	marker := " " + regexp.QuoteMeta(cronMarker(command)) + "[[:space:]]*$"
+	others := fmt.Sprintf("{ %s -l 2>/dev/null | grep -v -E %s || true; }", crontab, shellQuote(marker))
+	if command.Action == instructions.CronRemove {
+		return fmt.Sprintf("%s | %s -", others, crontab), nil
+	}
+	return fmt.Sprintf("{ %s; echo %s; } | %s -", others, shellQuote(cronLine(command)), crontab), nil
 }
 
-// Delete - build local delete command
-func (l LocalBuilder) Delete(command instructions.DeleteCommand) string {
-	cmd := []string{l.conf.Configs["builder.local.delete"]}
-	return strings.Join(cmd, " ")
+// Delete - build local delete command, every path is checked against the
+// allowed roots, then only removed if it exists. Relative paths are resolved
+// against the WORKDIR, they're rejected while it isn't absolute. Globs
+// matching nothing are left as is by the shell and skipped by the check.
+func (l *LocalBuilder) Delete(command instructions.DeleteCommand) (string, error) {
+	roots := strings.Split(l.conf.Get("delete_allowed_roots"), ",")
+	for _, p := range command.SourcesAndDest {
+		if err := instructions.ValidateDeletePath(p, command.Force); err != nil {
+			return "", err
+		}
+		if shell.HasRefs(p) {
+			if !command.Force {
+				return "", errors.Errorf("DELETE %s depends on variables only known on the target, use --force to remove it", shell.Source(p))
+			}
+			continue
+		}
+		if !path.IsAbs(p) {
+			return "", errors.Errorf("DELETE %s is relative without an absolute WORKDIR, set one or use an absolute path", p)
+		}
+		if !isUnderAny(p, roots) {
+			return "", errors.Errorf("DELETE %s is outside of the allowed roots %s, set delete_allowed_roots", p, strings.Join(roots, ", "))
+		}
+	}
+
+	remove := fmt.Sprintf(`%s -- "$DROPLET_PATH"`, l.conf.Get("builder.local.delete"))
+	if command.DryRun {
+		remove = `echo "droplet: would remove $DROPLET_PATH" >&2`
+	}
+	return fmt.Sprintf(`for DROPLET_PATH in %s; do if [ -e "$DROPLET_PATH" ] || [ -L "$DROPLET_PATH" ]; then %s; fi; done`,
+		shellJoinGlob(command.SourcesAndDest), remove), nil
 }
 
 // Env - build local env command
-func (l LocalBuilder) Env(command instructions.EnvCommand) string {
-	cmd := []string{l.conf.Configs["builder.local.env"]}
-	return strings.Join(cmd, " ")
+func (l *LocalBuilder) Env(command instructions.EnvCommand) (string, error) {
+	cmd := []string{l.conf.Get("builder.local.env")}
+	for _, env := range command.Env {
+		cmd = append(cmd, env.Key+"="+shellQuote(env.Value))
+	}
+	return strings.Join(cmd, " "), nil
 }
 
-// Expose - build local expose command
-func (l LocalBuilder) Expose(command instructions.ExposeCommand) string {
-	cmd := []string{l.conf.Configs["builder.local.expose"]}
-	return strings.Join(cmd, " ")
+// Expose - build local expose command, the rules are generated for the
+// firewall set in the config
+func (l *LocalBuilder) Expose(command instructions.ExposeCommand) (string, error) {
+	fw, err := getFirewall(l.conf)
+	if err != nil {
+		return "", err
+	}
+	specs, err := command.PortSpecs()
+	if err != nil {
+		return "", err
+	}
+
+	cmd := []string{}
+	for _, spec := range specs {
+		cmd = append(cmd, fw.allow(l.conf, spec))
+	}
+	if fw.reload != nil {
+		cmd = append(cmd, fw.reload(l.conf))
+	}
+	return andThen(cmd...), nil
 }
 
 // Label - build local label command
-func (l LocalBuilder) Label(command instructions.LabelCommand) string {
-	cmd := []string{l.conf.Configs["builder.local.label"]}
-	return strings.Join(cmd, " ")
+func (l *LocalBuilder) Label(command instructions.LabelCommand) (string, error) {
+	cmd := []string{}
+	for _, label := range command.Labels {
+		cmd = append(cmd, fmt.Sprintf("%s %s", l.conf.Get("builder.local.label"), shellQuote(label.String())))
+	}
+	return andThen(cmd...), nil
 }
 
 // Run -build local run command
-func (l LocalBuilder) Run(command instructions.RunCommand) string {
-	return ""
+func (l *LocalBuilder) Run(command instructions.RunCommand) (string, error) {
+	if l.user != "" && command.PrependShell {
+		return l.runAs("sh -c " + shellQuote(cmdLine(command.ShellDependantCmdLine))), nil
+	}
+	return l.runAs(cmdLine(command.ShellDependantCmdLine)), nil
+}
+
+// User -build local user command, the user is created when asked, or checked
+func (l *LocalBuilder) User(command instructions.UserCommand) (string, error) {
+	cmd := l.checkUser(command)
+	if command.Create {
+		cmd = l.createUser(command)
+	}
+
+	l.user, l.group = "", ""
+	if !command.IsRoot() {
+		l.user, l.group = command.UserAndGroup()
+	}
+	return cmd, nil
+}
+
+// Package - build local package command, the action is run by the package
+// manager of --manager or set in the config, or by the one detected on the
+// target when the package manager is auto. The packages already installed are
+// skipped when package_manager_skip_installed is true.
+func (l *LocalBuilder) Package(command instructions.PackageCommand) (string, error) {
+	name := command.Manager
+	if name == "" {
+		name = l.conf.Get("package_manager")
+	}
+	skipInstalled := l.conf.Get("package_manager_skip_installed") == "true"
+	if name == autoPackageManager {
+		return autoPackage(command, skipInstalled), nil
+	}
+
+	manager := packagemanagers.GetManager(name)
+	if manager == nil {
+		return "", errors.Errorf("unknown package manager %s", name)
+	}
+	return managerPackage(name, manager, command, skipInstalled)
+}
+
+// Repository - build local repository command, the repository is added or
+// removed by the package manager set in the config, or by the one detected on
+// the target when the package manager is auto
+func (l *LocalBuilder) Repository(command instructions.RepositoryCommand) (string, error) {
+	name := l.conf.Get("package_manager")
+	if name == autoPackageManager {
+		return autoRepository(command), nil
+	}
+
+	manager := packagemanagers.GetManager(name)
+	if manager == nil {
+		return "", errors.Errorf("unknown package manager %s", name)
+	}
+	return managerRepository(name, manager, command)
 }
 
-// User -build local user command
-func (l LocalBuilder) User(command instructions.UserCommand) string {
-	cmd := []string{l.conf.Configs["builder.local.user"]}
-	return strings.Join(cmd, " ")
+// Workdir - build local workdir command, the dir is created when missing. A
+// relative dir is relative to the dir of the previous WORKDIR, which the
+// script is already in.
+func (l *LocalBuilder) Workdir(command instructions.WorkdirCommand) (string, error) {
+	dir := command.Path
+	if path.IsAbs(command.Resolved) {
+		dir = command.Resolved
+	}
+	return andThen(
+		fmt.Sprintf("%s %s", l.conf.Get("builder.local.mkdir"), shellQuote(dir)),
+		fmt.Sprintf("%s %s", l.conf.Get("builder.local.workdir"), shellQuote(dir)),
+	), nil
 }
 
-// Package - build local package command
-func (l LocalBuilder) Package(command instructions.PackageCommand) string {
-	return ""
+// isUnderAny returns whether the path is inside of one of the roots
+func isUnderAny(p string, roots []string) bool {
+	for _, root := range roots {
+		root = strings.TrimSpace(root)
+		if root != "" && instructions.IsUnder(p, root) {
+			return true
+		}
+	}
+	return false
 }
 
-// Workdir - build local workdir command
-func (l LocalBuilder) Workdir(command instructions.WorkdirCommand) string {
-	cmd := []string{l.conf.Configs["builder.local.workdir"]}
-	return strings.Join(cmd, " ")
+// mkdir creates the directory a copy is written to.
+func (l *LocalBuilder) mkdir(dest string, isDir bool) string {
+	if !isDir && !strings.HasSuffix(dest, "/") {
+		dest = path.Dir(dest)
+	}
+	if dest == "." || dest == "/" {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", l.conf.Get("builder.local.mkdir"), shellQuote(dest))
 }
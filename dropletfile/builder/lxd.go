@@ -1 +1,276 @@
 package builder
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/getopendroplet/droplet/config"
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+
+	"github.com/pkg/errors"
+)
+
+var reNumeric = regexp.MustCompile(`^[0-9]+$`)
+
+func init() {
+	AddBuilder("lxd", func(conf *config.Config, opts BuildOpts) (Builder, error) {
+		return NewLXDBuilder(conf, opts)
+	})
+}
+
+// LXDBuilder - build a script running the commands in an LXD instance with
+// lxc exec and lxc file push. Like for the local builder, only RUN and COPY
+// run as the user of the last USER instruction.
+type LXDBuilder struct {
+	LocalBuilder
+	instance string
+	user     string
+	uid      string
+	gid      string
+	workdir  string
+	args     []string
+	env      instructions.KeyValuePairs
+}
+
+// NewLXDBuilder returns a LXDBuilder for the instance given by the build
+// options, or by the builder.lxd.instance config key.
+func NewLXDBuilder(conf *config.Config, opts BuildOpts) (*LXDBuilder, error) {
+	instance := opts.Instance
+	if instance == "" {
+		instance = conf.Get("builder.lxd.instance")
+	}
+	if instance == "" {
+		return nil, errors.New("no lxd instance given, use --instance or set builder.lxd.instance")
+	}
+
+	return &LXDBuilder{
+		LocalBuilder: LocalBuilder{conf: conf},
+		instance:     instance,
+	}, nil
+}
+
+// Arg - build lxd arg command
+func (l *LXDBuilder) Arg(command instructions.ArgCommand) (string, error) {
+	// Args are set in the script and passed to every lxc exec
+	for _, arg := range command.Args {
+		l.args = append(l.args, arg.Key)
+	}
+	return l.LocalBuilder.Arg(command)
+}
+
+// Config - build lxd config command
+func (l *LXDBuilder) Config(command instructions.ConfigCommand) (string, error) {
+	return l.wrap(l.LocalBuilder.Config(command))
+}
+
+// Copy - build lxd copy command
+func (l *LXDBuilder) Copy(command instructions.CopyCommand) (string, error) {
+	return l.push(command.SourcesAndDest, command.Chown, command.Chmod)
+}
+
+// Cron - build lxd cron command
+func (l *LXDBuilder) Cron(command instructions.CronCommand) (string, error) {
+	return l.wrap(l.LocalBuilder.Cron(command))
+}
+
+// Delete - build lxd delete command
+func (l *LXDBuilder) Delete(command instructions.DeleteCommand) (string, error) {
+	return l.wrap(l.LocalBuilder.Delete(command))
+}
+
+// Env - build lxd env command
+func (l *LXDBuilder) Env(command instructions.EnvCommand) (string, error) {
+	l.env = append(l.env, command.Env...)
+	return "", nil
+}
+
+// Expose - build lxd expose command, forwarding the ports of the host to the
+// instance with proxy devices. Proxy devices can't filter the source, use a
+// firewall on the host for that.
+func (l *LXDBuilder) Expose(command instructions.ExposeCommand) (string, error) {
+	specs, err := command.PortSpecs()
+	if err != nil {
+		return "", err
+	}
+
+	cmd := []string{}
+	for _, spec := range specs {
+		device := fmt.Sprintf("droplet-%s-%s", spec.Protocol, spec.Ports("-"))
+		cmd = append(cmd, fmt.Sprintf("{ %s config device get %s %s type >/dev/null 2>&1 || %s config device add %s %s proxy %s %s; }",
+			l.conf.Get("builder.lxd.lxc"), shellQuote(l.instance), shellQuote(device),
+			l.conf.Get("builder.lxd.lxc"), shellQuote(l.instance), shellQuote(device),
+			shellQuote(fmt.Sprintf("listen=%s:0.0.0.0:%s", spec.Protocol, spec.Ports("-"))),
+			shellQuote(fmt.Sprintf("connect=%s:127.0.0.1:%s", spec.Protocol, spec.Ports("-")))))
+	}
+	return andThen(cmd...), nil
+}
+
+// Label - build lxd label command, labels are stored as user config keys
+func (l *LXDBuilder) Label(command instructions.LabelCommand) (string, error) {
+	cmd := []string{}
+	for _, label := range command.Labels {
+		cmd = append(cmd, fmt.Sprintf("%s config set %s %s %s",
+			l.conf.Get("builder.lxd.lxc"), shellQuote(l.instance), shellQuote("user."+label.Key), shellQuote(label.Value)))
+	}
+	return andThen(cmd...), nil
+}
+
+// Run - build lxd run command
+func (l *LXDBuilder) Run(command instructions.RunCommand) (string, error) {
+	if command.PrependShell {
+		cmd, err := l.LocalBuilder.Run(command)
+		if err != nil {
+			return "", err
+		}
+		return l.execAs("sh -c " + shellQuote(cmd)), nil
+	}
+	return l.execAs(shellJoin(command.CmdLine)), nil
+}
+
+// User - build lxd user command, lxc exec only takes numeric ids so names are
+// looked up in the instance once the user is created
+func (l *LXDBuilder) User(command instructions.UserCommand) (string, error) {
+	user, group := command.UserAndGroup()
+
+	cmd := []string{}
+	if command.Create {
+		create, _ := l.wrap(l.LocalBuilder.createUser(command), nil)
+		cmd = append(cmd, create)
+	}
+
+	l.user, l.uid, l.gid = "", "", ""
+	if !command.IsRoot() {
+		l.user = command.User
+	}
+	lookups := []string{}
+	if user != "" {
+		l.uid = "$DROPLET_UID"
+		lookups = append(lookups, "DROPLET_UID="+l.lookup(user, "id -u"))
+		if group == "" {
+			l.gid = "$DROPLET_GID"
+			lookups = append(lookups, "DROPLET_GID="+l.lookup(user, "id -g"))
+		}
+	}
+	if group != "" {
+		l.gid = "$DROPLET_GID"
+		lookups = append(lookups, "DROPLET_GID="+l.lookupGroup(group))
+	}
+	return andThen(append(cmd, strings.Join(lookups, " "))...), nil
+}
+
+// Package - build lxd package command
+func (l *LXDBuilder) Package(command instructions.PackageCommand) (string, error) {
+	return l.wrap(l.LocalBuilder.Package(command))
+}
+
+// Repository - build lxd repository command
+func (l *LXDBuilder) Repository(command instructions.RepositoryCommand) (string, error) {
+	return l.wrap(l.LocalBuilder.Repository(command))
+}
+
+// Workdir - build lxd workdir command
+func (l *LXDBuilder) Workdir(command instructions.WorkdirCommand) (string, error) {
+	// Relative dirs are relative to the root until an absolute WORKDIR
+	workdir := path.Join("/", command.Resolved)
+
+	// The dir is created before lxc exec is told to use it
+	cmd := l.exec(fmt.Sprintf("%s %s", l.conf.Get("builder.local.mkdir"), shellQuote(workdir)))
+	l.workdir = workdir
+	return cmd, nil
+}
+
+func (l *LXDBuilder) push(sd instructions.SourcesAndDest, chown string, chmod string) (string, error) {
+	dest := sd.Dest()
+	if !path.IsAbs(dest) {
+		isDir := strings.HasSuffix(dest, "/")
+		dest = path.Join("/", l.workdir, dest)
+		if isDir {
+			dest += "/"
+		}
+	}
+
+	args := []string{l.conf.Get("builder.lxd.lxc"), "file", "push", "-r", "-p", shellJoinGlob(sd.Sources()), shellQuote(l.instance + dest)}
+	cmd := []string{strings.Join(args, " ")}
+
+	// lxc file push can't set the owner nor the mode of a recursive push,
+	// they're changed in the instance. Files are owned by the user of the
+	// last USER instruction without --chown.
+	if chown == "" {
+		chown = l.user
+	}
+	targets := []string{dest}
+	if len(sd.Sources()) > 1 || strings.HasSuffix(dest, "/") {
+		targets = make([]string, len(sd.Sources()))
+		for i, src := range sd.Sources() {
+			targets[i] = path.Join(dest, path.Base(src))
+		}
+	}
+	if chown != "" {
+		cmd = append(cmd, l.shell(fmt.Sprintf("%s -R %s %s", l.conf.Get("builder.local.chown"), shellQuote(chown), shellJoinGlob(targets))))
+	}
+	if chmod != "" {
+		cmd = append(cmd, l.shell(fmt.Sprintf("%s -R %s %s", l.conf.Get("builder.local.chmod"), shellQuote(chmod), shellJoinGlob(targets))))
+	}
+	return andThen(cmd...), nil
+}
+
+// lookup returns a numeric id as is, or a lookup of the id in the instance
+func (l *LXDBuilder) lookup(name string, cmd string) string {
+	if reNumeric.MatchString(name) {
+		return name
+	}
+	return fmt.Sprintf(`"$(%s exec %s -- %s %s)"`, l.conf.Get("builder.lxd.lxc"), shellQuote(l.instance), cmd, shellQuote(name))
+}
+
+func (l *LXDBuilder) lookupGroup(name string) string {
+	if reNumeric.MatchString(name) {
+		return name
+	}
+	return fmt.Sprintf(`"$(%s exec %s -- getent group %s | cut -d: -f3)"`, l.conf.Get("builder.lxd.lxc"), shellQuote(l.instance), shellQuote(name))
+}
+
+// wrap turns a shell command into a lxc exec run as root
+func (l *LXDBuilder) wrap(cmd string, err error) (string, error) {
+	if err != nil || cmd == "" {
+		return cmd, err
+	}
+	return l.shell(cmd), nil
+}
+
+// shell returns a lxc exec of a shell command line run as root
+func (l *LXDBuilder) shell(cmd string) string {
+	return l.exec("sh -c " + shellQuote(cmd))
+}
+
+// exec returns a lxc exec of cmd run as root with the current workdir and env
+func (l *LXDBuilder) exec(cmd string) string {
+	return l.lxcExec(cmd, "", "")
+}
+
+// execAs returns a lxc exec of cmd run as the user of the last USER
+// instruction
+func (l *LXDBuilder) execAs(cmd string) string {
+	return l.lxcExec(cmd, l.uid, l.gid)
+}
+
+// lxcExec passes the args with their value in the script, the env is
+// exported in the instance so that it refers to the variables set there
+func (l *LXDBuilder) lxcExec(cmd string, uid string, gid string) string {
+	args := []string{l.conf.Get("builder.lxd.lxc"), "exec", shellQuote(l.instance)}
+	if uid != "" {
+		args = append(args, "--user", `"`+uid+`"`)
+	}
+	if gid != "" {
+		args = append(args, "--group", `"`+gid+`"`)
+	}
+	if l.workdir != "" {
+		args = append(args, "--cwd", shellQuote(l.workdir))
+	}
+	for _, arg := range l.args {
+		args = append(args, "--env", fmt.Sprintf("%s=\"$%s\"", arg, arg))
+	}
+
+	return strings.Join(append(args, "--", exportEnv(l.conf.Get("builder.local.env"), l.env, cmd)), " ")
+}
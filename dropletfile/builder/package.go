@@ -0,0 +1,216 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/packagemanagers"
+
+	"github.com/pkg/errors"
+)
+
+// autoPackageManager is the package_manager detecting the package manager of
+// the target when the script runs
+const autoPackageManager = "auto"
+
+// detectPackageManager sets DROPLET_PACKAGE_MANAGER from the ID and ID_LIKE
+// of /etc/os-release, falling back to the first package manager found in the
+// PATH. The variable is only set once so that the detection runs once per
+// shell.
+var detectPackageManager = strings.Join([]string{
+	`: "${DROPLET_PACKAGE_MANAGER:=$(`,
+	`if [ -r /etc/os-release ]; then . /etc/os-release; fi; `,
+	`case " ${ID-} ${ID_LIKE-} " in `,
+	`*" alpine "*) echo apk;; `,
+	`*" debian "*|*" ubuntu "*) echo apt;; `,
+	`*" fedora "*|*" rhel "*|*" centos "*) if command -v dnf >/dev/null 2>&1; then echo dnf; else echo yum; fi;; `,
+	`*" suse "*|*" opensuse "*) echo zypper;; `,
+	`*" arch "*) echo pacman;; `,
+	`*) for m in apt-get dnf yum zypper pacman apk brew; do `,
+	`if command -v $m >/dev/null 2>&1; then echo ${m%-get}; break; fi; `,
+	`done;; `,
+	`esac)}"`,
+}, "")
+
+// managerPackage builds the command of a PACKAGE instruction for a package
+// manager. Updating packages refreshes the package index, then installs the
+// latest version of the packages. With --target, the packages are installed
+// to the target dir instead of the system. With skipInstalled, only the
+// packages which aren't installed yet are installed, and only the installed
+// ones are removed.
+func managerPackage(name string, manager *packagemanagers.Manager, command instructions.PackageCommand, skipInstalled bool) (string, error) {
+	if command.Target != "" {
+		var err error
+		if manager, err = manager.WithTarget(command.Target); err != nil {
+			return "", errors.Wrapf(err, "package manager %s", name)
+		}
+	}
+
+	names := make([]string, len(command.Packages))
+	packages := make([]string, len(command.Packages))
+	checks := make([]string, len(command.Packages))
+	for i, p := range command.Packages {
+		pkg, version := command.Package(p, name)
+		if version == "" {
+			// The package may be pinned with the syntax of the manager
+			pkg, version = manager.SplitPinned(pkg)
+		}
+		if command.Action == instructions.PackageRemove {
+			// Any version of the package is removed
+			version = ""
+		}
+		pinned, err := manager.PinPackage(pkg, version)
+		if err != nil {
+			return "", errors.Wrapf(err, "package manager %s", name)
+		}
+		names[i] = pkg
+		packages[i] = shellQuote(pinned)
+		checks[i] = installedCheck(manager, pkg, version)
+	}
+
+	skip := skipInstalled && !manager.OnePackage && manager.Query.Installed != ""
+
+	var cmd string
+	switch command.Action {
+	case instructions.PackageInstall:
+		if skip && len(packages) > 0 {
+			cmd = onlyChanged(manager.Install([]string{`"$@"`}, nil), names, packages, checks, false)
+		} else {
+			cmd = manager.Install(packages, nil)
+		}
+	case instructions.PackageRemove:
+		if skip && len(packages) > 0 {
+			cmd = onlyChanged(manager.Remove([]string{`"$@"`}, nil), names, packages, checks, true)
+		} else {
+			cmd = manager.Remove(packages, nil)
+		}
+	case instructions.PackageUpdate:
+		cmd = manager.Update()
+		if cmd != "" && len(packages) > 0 {
+			cmd = andThen(cmd, manager.Install(packages, nil))
+		}
+	case instructions.PackageUpgrade:
+		cmd = manager.Upgrade()
+	case instructions.PackageClean:
+		cmd = manager.Clean()
+	}
+	if cmd == "" {
+		return "", errors.Errorf("package manager %s can't %s packages", name, command.Action)
+	}
+	return cmd, nil
+}
+
+// installedCheck returns the command succeeding when a package is installed
+// at a version, empty when the manager can't tell. A version matches the
+// installed one, a glob like 1.18* too, followed by a -release suffix or not.
+// The exact pin ==1.2 of pip matches 1.2.
+func installedCheck(manager *packagemanagers.Manager, name string, version string) string {
+	if version == "" {
+		return manager.IsInstalled(name)
+	}
+
+	version = strings.TrimPrefix(version, "==")
+	installed := manager.InstalledVersion(name)
+	if installed == "" || version == "" || strings.ContainsAny(version[:1], "<>=~") {
+		// Ranges can't be checked, the package manager resolves them
+		return ""
+	}
+	pattern := shellQuoteGlob(version)
+	return fmt.Sprintf(`case "$( { %s; } 2>/dev/null )" in %s|%s-*) true;; *) false;; esac`, installed, pattern, pattern)
+}
+
+// onlyChanged builds a command running the package manager for the packages
+// which need it, collected in "$@", then printing what changed. The packages
+// without a check always need it.
+func onlyChanged(run string, names []string, packages []string, checks []string, remove bool) string {
+	changed, unchanged := "installed", "already installed"
+	if remove {
+		changed, unchanged = "removed", "not installed"
+	}
+
+	cmd := []string{"set --", "DROPLET_CHANGED=''", "DROPLET_UNCHANGED=''"}
+	for i := range packages {
+		change := fmt.Sprintf(`set -- "$@" %s; DROPLET_CHANGED="$DROPLET_CHANGED "%s`, packages[i], shellQuote(names[i]))
+		keep := fmt.Sprintf(`DROPLET_UNCHANGED="$DROPLET_UNCHANGED "%s`, shellQuote(names[i]))
+		switch {
+		case checks[i] == "":
+			cmd = append(cmd, "{ "+change+"; }")
+		case remove:
+			cmd = append(cmd, fmt.Sprintf("if %s; then %s; else %s; fi", checks[i], change, keep))
+		default:
+			cmd = append(cmd, fmt.Sprintf("if %s; then %s; else %s; fi", checks[i], keep, change))
+		}
+	}
+	cmd = append(cmd,
+		fmt.Sprintf(`if [ $# -gt 0 ]; then %s; fi`, run),
+		fmt.Sprintf(`echo "droplet: %s:${DROPLET_CHANGED:- none}, %s:${DROPLET_UNCHANGED:- none}" >&2`, changed, unchanged),
+	)
+	return andThen(cmd...)
+}
+
+// autoPackage builds the command of a PACKAGE instruction for every package
+// manager, the one detected on the target is run
+func autoPackage(command instructions.PackageCommand, skipInstalled bool) string {
+	return autoManager(func(name string, manager *packagemanagers.Manager) (string, error) {
+		return managerPackage(name, manager, command, skipInstalled)
+	})
+}
+
+// managerRepository builds the command of a REPOSITORY instruction for a
+// package manager
+func managerRepository(name string, manager *packagemanagers.Manager, command instructions.RepositoryCommand) (string, error) {
+	repository := packagemanagers.Repository{
+		Name:       command.RepositoryName,
+		URL:        command.URL,
+		Key:        command.Key,
+		Suite:      command.Suite,
+		Components: command.Components,
+	}
+
+	var cmd string
+	var err error
+	if command.Action == instructions.RepositoryRemove {
+		cmd, err = manager.RemoveRepository(repository)
+	} else {
+		cmd, err = manager.AddRepository(repository)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "package manager %s", name)
+	}
+	return cmd, nil
+}
+
+// autoRepository builds the command of a REPOSITORY instruction for every
+// package manager, the one detected on the target is run
+func autoRepository(command instructions.RepositoryCommand) string {
+	return autoManager(func(name string, manager *packagemanagers.Manager) (string, error) {
+		return managerRepository(name, manager, command)
+	})
+}
+
+// autoManager builds a case running the command built for the package manager
+// detected on the target, the package managers the command can't be built for
+// fail the script. The language package managers are never detected.
+func autoManager(build func(name string, manager *packagemanagers.Manager) (string, error)) string {
+	names := []string{}
+	for name, manager := range packagemanagers.Managers() {
+		if !manager.Language {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	cases := []string{}
+	for _, name := range names {
+		cmd, err := build(name, packagemanagers.GetManager(name))
+		if err != nil {
+			cmd = fmt.Sprintf("echo %s >&2; exit 1", shellQuote("droplet: "+err.Error()))
+		}
+		cases = append(cases, fmt.Sprintf("%s) %s;;", name, cmd))
+	}
+	cases = append(cases, `*) echo "droplet: no supported package manager found" >&2; exit 1;;`)
+
+	return fmt.Sprintf(`%s && case "$DROPLET_PACKAGE_MANAGER" in %s esac`, detectPackageManager, strings.Join(cases, " "))
+}
@@ -0,0 +1,66 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+// packageActionsDropletfile uses every action, and the actions set by the
+// stages
+const packageActionsDropletfile = `STAGE install
+PACKAGE --action=update
+PACKAGE --action=upgrade
+PACKAGE curl
+PACKAGE --action=update curl
+PACKAGE --action=remove vim
+PACKAGE --action=clean
+
+STAGE update
+PACKAGE curl
+
+STAGE remove
+PACKAGE curl
+`
+
+func TestPackageActions(t *testing.T) {
+	// apk runs without a cache, it has nothing to clean
+	for _, manager := range []string{"apt", "dnf", "pacman", "zypper"} {
+		t.Run(manager, func(t *testing.T) {
+			conf := testConfig(map[string]string{"package_manager": manager, "package_manager_skip_installed": "false"})
+			script := buildTestScript(t, conf, "local", packageActionsDropletfile)
+			assertGolden(t, "package-actions-"+manager, script)
+			assertBashSyntax(t, script)
+		})
+	}
+}
+
+func TestPackageActionByStage(t *testing.T) {
+	dropletfile := "STAGE remove\nPACKAGE curl\n"
+	tests := map[string]string{
+		"true":  "apk --no-cache del --rdepends curl",
+		"false": "apk --no-cache add curl",
+	}
+	for byStage, expected := range tests {
+		conf := testConfig(map[string]string{"package_manager_action_by_stage": byStage, "package_manager_skip_installed": "false"})
+		if script := buildTestScript(t, conf, "local", dropletfile); !strings.Contains(script, "\n"+expected+"\n") {
+			t.Errorf("action by stage %s: expected %q\n%s", byStage, expected, script)
+		}
+	}
+}
+
+func TestPackageErrors(t *testing.T) {
+	tests := map[string]string{
+		"STAGE install\nPACKAGE --action=purge curl\n":            "invalid PACKAGE action \"purge\"",
+		"STAGE install\nPACKAGE --action=install\n":               "PACKAGE --action=install requires at least one package",
+		"STAGE remove\nPACKAGE\n":                                 "PACKAGE --action=remove requires at least one package",
+		"STAGE install\nPACKAGE --manager=pkg curl\n":             "unknown package manager pkg",
+		"STAGE install\nPACKAGE --manager=pip --action=upgrade\n": "package manager pip can't upgrade packages",
+		"STAGE install\nPACKAGE --action=clean\n":                 "package manager apk can't clean packages",
+	}
+	for dropletfile, expected := range tests {
+		_, err := buildTest(testConfig(nil), "local", dropletfile, nil)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected the error %q, got %v", dropletfile, expected, err)
+		}
+	}
+}
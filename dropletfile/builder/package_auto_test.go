@@ -0,0 +1,138 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCommands writes fake commands to a dir
+func writeCommands(t *testing.T, dir string, commands map[string]string) {
+	t.Helper()
+
+	for name, script := range commands {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetectPackageManager(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	tests := []struct {
+		name      string
+		osRelease string
+		commands  []string
+		env       string
+		expected  string
+	}{
+		{"alpine", "ID=alpine\n", nil, "", "apk"},
+		{"ubuntu", "ID=ubuntu\nID_LIKE=debian\n", nil, "", "apt"},
+		{"debian derivative", "ID=raspbian\nID_LIKE=debian\n", nil, "", "apt"},
+		{"rocky with dnf", "ID=rocky\nID_LIKE=\"rhel centos fedora\"\n", []string{"dnf"}, "", "dnf"},
+		{"centos without dnf", "ID=centos\nID_LIKE=\"rhel fedora\"\n", nil, "", "yum"},
+		{"opensuse", "ID=opensuse-leap\nID_LIKE=\"suse opensuse\"\n", nil, "", "zypper"},
+		{"arch", "ID=arch\n", nil, "", "pacman"},
+		{"unknown with apt-get", "ID=custom\n", []string{"apt-get", "apk"}, "", "apt"},
+		{"no os-release", "", []string{"zypper", "brew"}, "", "zypper"},
+		{"nothing found", "", nil, "", ""},
+		{"already detected", "ID=alpine\n", nil, "pacman", "pacman"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "detect")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			osRelease := filepath.Join(dir, "os-release")
+			if test.osRelease != "" {
+				if err := ioutil.WriteFile(osRelease, []byte(test.osRelease), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			commands := map[string]string{}
+			for _, name := range test.commands {
+				commands[name] = "exit 0"
+			}
+			writeCommands(t, dir, commands)
+
+			// The detection only uses builtins, the PATH only has the fake
+			// commands
+			detect := strings.Replace(detectPackageManager, "/etc/os-release", osRelease, -1)
+			cmd := exec.Command(bash, "-c", detect+` && echo "$DROPLET_PACKAGE_MANAGER"`)
+			cmd.Env = []string{"PATH=" + dir}
+			if test.env != "" {
+				cmd.Env = append(cmd.Env, "DROPLET_PACKAGE_MANAGER="+test.env)
+			}
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			if res := strings.TrimSpace(string(out)); res != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, res)
+			}
+		})
+	}
+}
+
+func TestAutoPackageManager(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	dir, err := ioutil.TempDir("", "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// No package is installed, apk prints the commands it is run for
+	writeCommands(t, dir, map[string]string{
+		"apk": `case "$1" in info) exit 1;; *) echo "apk $*";; esac`,
+	})
+
+	conf := testConfig(map[string]string{"package_manager": "auto"})
+	script := buildTestScript(t, conf, "local", "STAGE install\nPACKAGE curl\n")
+	run := func(manager string) (string, error) {
+		cmd := exec.Command(bash, "-c", script)
+		cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"), "DROPLET_PACKAGE_MANAGER="+manager)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	out, err := run("apk")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.Contains(out, "apk --no-cache add curl") {
+		t.Errorf("expected apk to install curl, got %q", out)
+	}
+
+	out, err = run("unknown")
+	if err == nil || !strings.Contains(out, "droplet: no supported package manager found") {
+		t.Errorf("expected the unsupported package manager error, got %v: %q", err, out)
+	}
+}
+
+func TestAutoPackageManagerUnsupported(t *testing.T) {
+	// apk can't clean, the case of apk fails the script
+	script := buildTestScript(t, testConfig(map[string]string{"package_manager": "auto"}), "local", "STAGE install\nPACKAGE --action=clean\n")
+	if !strings.Contains(script, "apk) echo 'droplet: package manager apk") || !strings.Contains(script, "exit 1;;") {
+		t.Errorf("expected apk to fail the script, got\n%s", script)
+	}
+	if strings.Contains(script, "pip)") || strings.Contains(script, "npm)") {
+		t.Errorf("the language package managers are detected\n%s", script)
+	}
+	assertBashSyntax(t, script)
+}
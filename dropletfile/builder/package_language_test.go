@@ -0,0 +1,45 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackageLanguage(t *testing.T) {
+	dropletfile := `STAGE install
+ARG VENV=/srv/app/venv
+PACKAGE --manager=pip --target=$VENV flask@2.0.1 gunicorn@>=20
+PACKAGE --manager=pip --target=$VENV requests==2.31
+PACKAGE --manager=npm pm2@5.1.0
+PACKAGE --manager=gem --target=/srv/app/gems bundler
+PACKAGE --manager=cargo ripgrep@12.1.1
+PACKAGE --manager=go --target=/usr/local/bin golang.org/x/tools/gopls github.com/go-delve/delve/cmd/dlv@v1.7.0
+PACKAGE --manager=pip --action=remove --target=$VENV flask
+`
+	for _, skipInstalled := range []string{"true", "false"} {
+		t.Run("skip-installed-"+skipInstalled, func(t *testing.T) {
+			conf := testConfig(map[string]string{"package_manager": "apt", "package_manager_skip_installed": skipInstalled})
+			script := buildTestScript(t, conf, "local", dropletfile)
+			assertGolden(t, "package-language-skip-installed-"+skipInstalled, script)
+			assertBashSyntax(t, script)
+		})
+	}
+}
+
+func TestPackageLanguageErrors(t *testing.T) {
+	tests := []struct {
+		dropletfile string
+		expected    string
+	}{
+		{"STAGE install\nPACKAGE --manager=conda numpy\n", "unknown package manager conda"},
+		{"STAGE install\nPACKAGE --manager=brew --target=/opt/brew wget\n", "package manager brew: install targets aren't supported, can't install to /opt/brew"},
+		{"STAGE install\nPACKAGE --manager=npm pm2@>=5\n", "package manager npm: version ranges aren't supported, can't install pm2@>=5"},
+		{"STAGE remove\nPACKAGE --manager=go --action=remove golang.org/x/tools/gopls\n", "package manager go can't remove packages"},
+	}
+	for _, test := range tests {
+		_, err := buildTest(testConfig(map[string]string{"package_manager": "apt"}), "local", test.dropletfile, nil)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%q: expected the error %q, got %v", test.dropletfile, test.expected, err)
+		}
+	}
+}
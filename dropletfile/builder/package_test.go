@@ -0,0 +1,154 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/packagemanagers"
+)
+
+func TestPackageOnlyChanged(t *testing.T) {
+	tests := []struct {
+		name        string
+		manager     string
+		dropletfile string
+	}{
+		{"package-install", "apt", "STAGE install\nPACKAGE curl nginx@1.18* git@1:2.30.2-1\nPACKAGE --manager=pip requests@==2.25.1 flask@>=1.1\n"},
+		{"package-remove", "apt", "STAGE remove\nPACKAGE --action=remove curl nginx@1.18*\n"},
+		{"package-auto", "auto", "STAGE install\nPACKAGE curl nginx@1.18*\nPACKAGE --action=remove vim\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script := buildTestScript(t, testConfig(map[string]string{"package_manager": test.manager}), "local", test.dropletfile)
+			assertGolden(t, test.name, script)
+			assertBashSyntax(t, script)
+		})
+	}
+}
+
+func TestPackageOnlyChangedRun(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	dir, err := ioutil.TempDir("", "package")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// curl is installed, vim was removed with its config files kept, apt
+	// prints the packages it is run for
+	commands := map[string]string{
+		"dpkg-query": `for p; do :; done
+case "$p" in
+curl) status='install ok installed' abbrev='ii ' version=7.74.0-1;;
+vim) status='deinstall ok config-files' abbrev='rc ' version=2:8.2-1;;
+*) echo "dpkg-query: no packages found matching $p" >&2; exit 1;;
+esac
+case "$2" in
+*Abbrev*) echo "$abbrev $version";;
+*) echo "$status";;
+esac`,
+		"apt": `echo "$@"`,
+	}
+	writeCommands(t, dir, commands)
+
+	conf := testConfig(map[string]string{"package_manager": "apt"})
+	run := func(dropletfile string) (string, string) {
+		t.Helper()
+		cmd := exec.Command(bash, "-c", buildTestScript(t, conf, "local", dropletfile))
+		cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		var stdout, stderr strings.Builder
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("%v: %s", err, stderr.String())
+		}
+		return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String())
+	}
+
+	tests := []struct {
+		dropletfile string
+		stdout      string
+		stderr      string
+	}{
+		{
+			"STAGE install\nPACKAGE curl vim@2:8.2* nginx@1.18*\n",
+			"-y install vim=2:8.2* nginx=1.18*",
+			"droplet: installed: vim nginx, already installed: curl",
+		},
+		{
+			"STAGE install\nPACKAGE curl@7.74.0\n",
+			"",
+			"droplet: installed: none, already installed: curl",
+		},
+		{
+			"STAGE remove\nPACKAGE --action=remove curl vim nginx\n",
+			"-y remove --auto-remove curl",
+			"droplet: removed: curl, not installed: vim nginx",
+		},
+	}
+	for _, test := range tests {
+		stdout, stderr := run(test.dropletfile)
+		if stdout != test.stdout {
+			t.Errorf("%q: expected apt %q, got %q", test.dropletfile, test.stdout, stdout)
+		}
+		if stderr != test.stderr {
+			t.Errorf("%q: expected the summary %q, got %q", test.dropletfile, test.stderr, stderr)
+		}
+	}
+}
+
+func TestPackagePin(t *testing.T) {
+	dropletfile := "STAGE install\nPACKAGE --map=php=dnf:php-fpm,apt:php7.4-fpm@7.4.3* php@7.4.16 curl\nPACKAGE --action=remove --map=dnf:vim-enhanced vim@8.2\n"
+	for _, manager := range []string{"apt", "dnf"} {
+		t.Run(manager, func(t *testing.T) {
+			conf := testConfig(map[string]string{"package_manager": manager, "package_manager_skip_installed": "false"})
+			script := buildTestScript(t, conf, "local", dropletfile)
+			assertGolden(t, "package-pin-"+manager, script)
+			assertBashSyntax(t, script)
+		})
+	}
+
+	_, err := buildTest(testConfig(map[string]string{"package_manager": "apt"}), "local", "STAGE install\nPACKAGE nginx@>=1.18\n", nil)
+	if err == nil || !strings.Contains(err.Error(), "package manager apt: version ranges aren't supported, can't install nginx@>=1.18") {
+		t.Errorf("expected the version range error, got %v", err)
+	}
+}
+
+func TestPackageMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer packagemanagers.ClearAliases()
+
+	file := filepath.Join(dir, packagemanagers.AliasFile)
+	if err := ioutil.WriteFile(file, []byte("php:\n  apt: php-fpm\n  apk: php7\nvim:\n  dnf: vim-enhanced\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := packagemanagers.LoadAliases(file); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &instructions.PackageCommand{
+		Packages: []string{"php@7.4", "curl"},
+		Map:      instructions.PackageMap{"php": {"apt": "php7.4-fpm", "dnf": "php-fpm"}},
+	}
+
+	// --map overrides the alias file, the aliases of the other packages are
+	// dropped
+	expected := instructions.PackageMap{"php": {"apt": "php7.4-fpm", "apk": "php7", "dnf": "php-fpm"}}
+	if res := packageMap(cmd); !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %v, got %v", expected, res)
+	}
+}
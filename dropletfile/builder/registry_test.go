@@ -0,0 +1,82 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getopendroplet/droplet/config"
+)
+
+// buildersDropletfile uses every instruction, it is built by each builder
+const buildersDropletfile = `STAGE install
+ARG VERSION=1.0
+ENV APP_HOME=/srv/app PATH=/opt/bin:$PATH
+LABEL version=$VERSION
+USER --create app
+WORKDIR $APP_HOME
+COPY --chown=app --chmod=640 a.txt conf/
+CONFIG a.txt /etc/app.conf
+CRON --name=report 0 * * * * report $VERSION
+DELETE /srv/app/cache
+EXPOSE 8080/tcp
+PACKAGE curl
+REPOSITORY --name=app --key=https://example.com/key.gpg https://example.com/debian
+RUN echo "$VERSION" > version
+RUN ["echo", "done"]
+`
+
+func TestBuilders(t *testing.T) {
+	conf := testConfig(map[string]string{
+		"builder.docker.container": "web",
+		"builder.docker.image":     "debian:bullseye",
+		"builder.ssh.host":         "example.com",
+		"package_manager":          "apt",
+	})
+	for _, name := range []string{"local", "docker", "dockerfile", "lxd", "ssh"} {
+		t.Run(name, func(t *testing.T) {
+			script := buildTestScript(t, conf, name, buildersDropletfile)
+			assertGolden(t, "builder-"+name, script)
+			if name != "dockerfile" {
+				assertBashSyntax(t, script)
+			}
+		})
+	}
+}
+
+func TestBuilderRegistry(t *testing.T) {
+	for _, name := range []string{"local", "docker", "dockerfile", "lxd", "ssh"} {
+		if !ExistsBuilder(name) {
+			t.Errorf("builder %s isn't registered", name)
+		}
+	}
+
+	if AddBuilder("local", func(conf *config.Config, opts BuildOpts) (Builder, error) { return nil, nil }) {
+		t.Error("a registered builder was replaced")
+	}
+
+	_, err := buildTest(testConfig(nil), "missing", "STAGE install\nRUN true\n", nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown builder missing, available builders: docker, dockerfile, local, lxd, ssh") {
+		t.Errorf("expected the unknown builder error, got %v", err)
+	}
+}
+
+func TestBuilderConfig(t *testing.T) {
+	tests := map[string]string{
+		"docker": "no docker container configured",
+		"lxd":    "", // the instance of the build options is used
+		"ssh":    "no ssh host",
+	}
+	conf := testConfig(map[string]string{"builder.docker.container": "", "builder.ssh.host": ""})
+	for name, expected := range tests {
+		_, err := buildTest(conf, name, "STAGE install\nRUN true\n", nil)
+		if expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected the error %q, got %v", name, expected, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepository(t *testing.T) {
+	dropletfile := `STAGE install
+ARG DISTRO=debian
+REPOSITORY --name=nginx --key=https://nginx.org/keys/nginx_signing.key https://nginx.org/packages/$DISTRO
+REPOSITORY --action=remove https://example.com/old
+`
+	for _, manager := range []string{"apt", "dnf", "apk", "auto"} {
+		t.Run(manager, func(t *testing.T) {
+			script := buildTestScript(t, testConfig(map[string]string{"package_manager": manager}), "local", dropletfile)
+			assertGolden(t, "repository-"+manager, script)
+			assertBashSyntax(t, script)
+		})
+	}
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	tests := []struct {
+		manager     string
+		dropletfile string
+		expected    string
+	}{
+		{"pacman", "STAGE install\nREPOSITORY https://example.com/arch\n", "package manager pacman: repositories aren't supported"},
+		{"brew", "STAGE install\nREPOSITORY --key=https://example.com/key homebrew/cask\n", "package manager brew: repository signing keys aren't supported"},
+		{"apt", "STAGE install\nREPOSITORY --name=../nginx https://nginx.org/packages/debian\n", `invalid repository name "../nginx"`},
+	}
+	for _, test := range tests {
+		_, err := buildTest(testConfig(map[string]string{"package_manager": test.manager}), "local", test.dropletfile, nil)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected the error %q, got %v", test.manager, test.expected, err)
+		}
+	}
+}
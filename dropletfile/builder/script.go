@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/getopendroplet/droplet/version"
+)
+
+// Step is a single built instruction of a script
+type Step struct {
+	Source  string
+	Command string
+}
+
+// Script is the result of a build
+type Script struct {
+	Dropletfile string
+	Stages      []string
+	Interpreter string   // shebang interpreter, empty when the output isn't executable
+	Prologue    []string // lines following the generated header
+	Steps       []Step
+	Warnings    []string
+	Manifest    []ManifestEntry // files copied to the target
+}
+
+// AddStep appends a built instruction to the script
+func (s *Script) AddStep(source string, command string) {
+	s.Steps = append(s.Steps, Step{Source: source, Command: command})
+}
+
+// Header returns the generated header of the script
+func (s *Script) Header() string {
+	build := version.Version
+	if version.Revision != "" {
+		build += " (" + version.Revision + ")"
+	}
+
+	lines := []string{}
+	if s.Interpreter != "" {
+		lines = append(lines, "#!"+s.Interpreter, "#")
+	}
+	lines = append(lines,
+		fmt.Sprintf("# Generated by %s %s. DO NOT EDIT.", version.Package, build),
+		"#",
+		"# Dropletfile: "+s.Dropletfile,
+	)
+	if len(s.Stages) == 1 {
+		lines = append(lines, "# Stage: "+s.Stages[0])
+	} else {
+		lines = append(lines, "# Stages: "+strings.Join(s.Stages, ", "))
+	}
+	lines = append(lines, "#")
+	lines = append(lines, s.Prologue...)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// WriteTo writes the script to w
+func (s *Script) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString(s.Header())
+	writeSteps(&buf, s.Steps)
+
+	return buf.WriteTo(w)
+}
+
+func writeSteps(buf *bytes.Buffer, steps []Step) {
+	for _, step := range steps {
+		buf.WriteString("\n")
+		if step.Source != "" {
+			buf.WriteString("# " + strings.Replace(step.Source, "\n", "\n# ", -1) + "\n")
+		}
+		buf.WriteString(step.Command + "\n")
+	}
+}
@@ -0,0 +1,128 @@
+package builder
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/dropletfile/shell"
+)
+
+var (
+	reShellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+	reGlob      = regexp.MustCompile(`[*?]+|\[[^/\]\x00]+\]`)
+)
+
+// shellQuote quotes a string so that it is read back by the shell as a single
+// literal word. The variables left for the target are expanded by the shell,
+// an unset one is empty.
+func shellQuote(s string) string {
+	if shell.HasRefs(s) {
+		var b strings.Builder
+		for i, part := range shell.SplitRefs(s) {
+			if i%2 == 1 {
+				b.WriteString(`"${` + part + `-}"`)
+			} else if part != "" {
+				b.WriteString(shellQuote(part))
+			}
+		}
+		return b.String()
+	}
+	if s == "" {
+		return "''"
+	}
+	if reShellSafe.MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellQuoteGlob quotes a path like shellQuote, but leaves glob patterns
+// unquoted so that they are still expanded by the shell.
+func shellQuoteGlob(s string) string {
+	matches := reGlob.FindAllStringIndex(s, -1)
+	if len(matches) == 0 {
+		return shellQuote(s)
+	}
+
+	var b strings.Builder
+	prev := 0
+	for _, m := range matches {
+		if m[0] > prev {
+			b.WriteString(shellQuote(s[prev:m[0]]))
+		}
+		b.WriteString(s[m[0]:m[1]])
+		prev = m[1]
+	}
+	if prev < len(s) {
+		b.WriteString(shellQuote(s[prev:]))
+	}
+
+	return b.String()
+}
+
+// shellJoin quotes every argument and joins them into a single command line.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// shellJoinGlob is shellJoin for a list of paths which may contain globs.
+func shellJoinGlob(paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuoteGlob(p)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// andThen chains non-empty commands so that each one only runs if the
+// previous one succeeded.
+func andThen(cmds ...string) string {
+	res := []string{}
+	for _, cmd := range cmds {
+		if cmd != "" {
+			res = append(res, cmd)
+		}
+	}
+
+	return strings.Join(res, " && ")
+}
+
+// cmdLine renders the command line of a RUN or CRON instruction. The shell
+// form is already a shell command line, the exec form has to be quoted.
+func cmdLine(cmd instructions.ShellDependantCmdLine) string {
+	if cmd.PrependShell {
+		return strings.Join(cmd.CmdLine, " ")
+	}
+
+	return shellJoin(cmd.CmdLine)
+}
+
+// cronLine renders a crontab entry for a CRON instruction, tagged with its
+// marker comment
+func cronLine(cmd instructions.CronCommand) string {
+	// An unescaped % is turned into a newline by cron
+	line := strings.Replace(cmdLine(cmd.ShellDependantCmdLine), "%", `\%`, -1)
+	return cmd.Schedule() + " " + line + " " + cronMarker(cmd)
+}
+
+// exportEnv runs cmd through a shell exporting the env first, the variables
+// the values refer to are resolved on the target rather than by the script
+func exportEnv(export string, env instructions.KeyValuePairs, cmd string) string {
+	if len(env) == 0 {
+		return cmd
+	}
+
+	exports := []string{export}
+	for _, kvp := range env {
+		exports = append(exports, kvp.Key+"="+shellQuote(kvp.Value))
+	}
+	return "sh -c " + shellQuote(strings.Join(exports, " ")+` && exec "$0" "$@"`) + " " + cmd
+}
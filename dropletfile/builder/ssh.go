@@ -1 +1,238 @@
 package builder
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/getopendroplet/droplet/config"
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// sshHeredoc delimits the script sent to the remote shell
+	sshHeredoc = "DROPLET_EOF"
+
+	// sshStaging is the variable holding the staging dir of the run, and
+	// sshStagingPlaceholder the path standing for it in the built commands
+	sshStaging            = "DROPLET_STAGING"
+	sshStagingPlaceholder = "/" + sshStaging
+)
+
+func init() {
+	AddBuilder("ssh", func(conf *config.Config, opts BuildOpts) (Builder, error) {
+		return NewSSHBuilder(conf)
+	})
+}
+
+// SSHBuilder - build commands executed on a remote host in a single ssh
+// session. Files copied from the build context are uploaded to a dir created
+// for the run in the staging dir of the remote host before the session
+// starts, the session removes it once done.
+type SSHBuilder struct {
+	LocalBuilder
+	host     string
+	user     string
+	port     string
+	identity string
+	staging  string
+	uploads  []Step
+}
+
+// NewSSHBuilder returns a SSHBuilder for the remote named by the
+// builder.ssh.remote config key, or for the builder.ssh.host config key.
+func NewSSHBuilder(conf *config.Config) (*SSHBuilder, error) {
+	s := &SSHBuilder{
+		LocalBuilder: LocalBuilder{conf: conf},
+		host:         conf.Get("builder.ssh.host"),
+		user:         conf.Get("builder.ssh.user"),
+		port:         conf.Get("builder.ssh.port"),
+		identity:     conf.Get("builder.ssh.identity"),
+		staging:      conf.Get("builder.ssh.staging"),
+	}
+
+	if name := conf.Get("builder.ssh.remote"); name != "" {
+		remote, ok := conf.Remotes[name]
+		if !ok {
+			return nil, errors.Errorf("Remote %s doesn't exist", name)
+		}
+		if err := s.setRemote(remote); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.host == "" {
+		return nil, errors.New("no ssh host configured, set builder.ssh.host or builder.ssh.remote")
+	}
+	if s.staging == "/" || !path.IsAbs(s.staging) || !reShellSafe.MatchString(s.staging) {
+		return nil, errors.Errorf("invalid ssh staging dir %q, expected an absolute path other than /", s.staging)
+	}
+
+	return s, nil
+}
+
+// setRemote reads the ssh destination from a remote address like
+// ssh://user@host:port
+func (s *SSHBuilder) setRemote(remote config.Remote) error {
+	addr := remote.Addr
+	if !strings.Contains(addr, "://") {
+		addr = "ssh://" + addr
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return errors.Wrapf(err, "invalid ssh remote address %s", remote.Addr)
+	}
+	if u.Scheme != "ssh" {
+		return errors.Errorf("remote address %s is not an ssh address", remote.Addr)
+	}
+
+	s.host = u.Hostname()
+	if u.User != nil {
+		s.user = u.User.Username()
+	}
+	if u.Port() != "" {
+		s.port = u.Port()
+	}
+	if remote.Identity != "" {
+		s.identity = remote.Identity
+	}
+
+	return nil
+}
+
+// Copy - build ssh copy command, the sources are read from the staging dir
+// of the run
+func (s *SSHBuilder) Copy(command instructions.CopyCommand) (string, error) {
+	command.SourcesAndDest = s.upload(command.String(), command.SourcesAndDest)
+	cmd, err := s.LocalBuilder.Copy(command)
+	if err != nil {
+		return "", err
+	}
+
+	staging := `"$` + sshStaging + `"`
+	cmd = strings.Replace(cmd, "'"+sshStagingPlaceholder+"/", staging+"'/", -1)
+	return strings.Replace(cmd, sshStagingPlaceholder+"/", staging+"/", -1), nil
+}
+
+// Finish moves the built steps into the ssh session, preceded by the uploads.
+// The staging dir of the run is made by mktemp so that only the files of the
+// run are removed.
+func (s *SSHBuilder) Finish(script *Script) error {
+	var body bytes.Buffer
+	writeSteps(&body, script.Steps)
+
+	for _, line := range strings.Split(body.String(), "\n") {
+		if line == sshHeredoc {
+			return errors.Errorf("the built script can't contain a %s line", sshHeredoc)
+		}
+	}
+
+	steps := []Step{}
+	session := []string{fmt.Sprintf("%s bash -s <<'%s'", s.ssh(), sshHeredoc), "set -euo pipefail"}
+	if len(s.uploads) > 0 {
+		dirs := make([]string, len(s.uploads))
+		for i := range s.uploads {
+			dirs[i] = s.uploadDir(i)
+		}
+		prepare := andThen(
+			fmt.Sprintf("mkdir -p %s", s.staging),
+			fmt.Sprintf(`%s="$(mktemp -d %s)"`, sshStaging, path.Join(s.staging, "run.XXXXXXXX")),
+			fmt.Sprintf("mkdir %s", strings.Join(dirs, " ")),
+			fmt.Sprintf(`echo "$%s"`, sshStaging),
+		)
+		steps = append(steps, Step{
+			Source:  "Prepare the staging dir of the run on the remote host",
+			Command: fmt.Sprintf(`%s="$(%s %s)"`, sshStaging, s.ssh(), shellQuote(prepare)),
+		})
+		steps = append(steps, s.uploads...)
+
+		session[0] = fmt.Sprintf(`%s %s="$%s" bash -s <<'%s'`, s.ssh(), sshStaging, sshStaging, sshHeredoc)
+		session = append(session, fmt.Sprintf("trap %s EXIT", shellQuote(fmt.Sprintf(`%s "$%s"`, s.conf.Get("builder.local.delete"), sshStaging))))
+	}
+
+	// The session is wrapped in braces so that bash reads all of it before
+	// running anything, commands reading stdin can't eat the script
+	session = append(session,
+		"{",
+		strings.TrimPrefix(body.String(), "\n"),
+		"}",
+		sshHeredoc,
+	)
+	steps = append(steps, Step{
+		Source:  "Run stage " + strings.Join(script.Stages, ", ") + " on " + s.destination(),
+		Command: strings.Join(session, "\n"),
+	})
+
+	script.Steps = steps
+	return nil
+}
+
+// upload adds an upload of the sources to a new dir of the staging dir, and
+// returns the sources and dest rewritten to point to it on the remote host.
+func (s *SSHBuilder) upload(source string, sd instructions.SourcesAndDest) instructions.SourcesAndDest {
+	n := strconv.Itoa(len(s.uploads) + 1)
+	dir := s.uploadDir(len(s.uploads))
+	sources := make([]string, len(sd.Sources()))
+	for i, src := range sd.Sources() {
+		sources[i] = path.Clean(src)
+	}
+
+	var cmd string
+	dest := shellQuote(s.destination()+":") + dir + "/"
+	copyCmd := s.conf.Get("builder.ssh.copy")
+	if strings.HasPrefix(copyCmd, "scp") {
+		cmd = fmt.Sprintf("%s %s %s %s", copyCmd, strings.Join(s.options("-P"), " "), shellJoinGlob(sources), dest)
+	} else {
+		cmd = fmt.Sprintf("%s -e %s %s %s", copyCmd, shellQuote(s.sshCommand()), shellJoinGlob(sources), dest)
+	}
+	s.uploads = append(s.uploads, Step{Source: "Upload " + source, Command: cmd})
+
+	res := instructions.SourcesAndDest{}
+	for _, src := range sources {
+		res = append(res, path.Join(sshStagingPlaceholder, n, path.Base(src)))
+	}
+	return append(res, sd.Dest())
+}
+
+// uploadDir returns the dir of an upload in the staging dir of the run, as
+// a shell word
+func (s *SSHBuilder) uploadDir(i int) string {
+	return fmt.Sprintf(`"$%s"/%d`, sshStaging, i+1)
+}
+
+// destination returns the [user@]host of the remote host
+func (s *SSHBuilder) destination() string {
+	if s.user == "" {
+		return s.host
+	}
+	return s.user + "@" + s.host
+}
+
+// options returns the port and identity options, ssh and scp use a
+// different flag for the port.
+func (s *SSHBuilder) options(portFlag string) []string {
+	opts := []string{}
+	if s.port != "" {
+		opts = append(opts, portFlag, shellQuote(s.port))
+	}
+	if s.identity != "" {
+		opts = append(opts, "-i", shellQuote(s.identity))
+	}
+	return opts
+}
+
+// sshCommand returns the ssh command with its options, without destination
+func (s *SSHBuilder) sshCommand() string {
+	return strings.Join(append([]string{s.conf.Get("builder.ssh.ssh")}, s.options("-p")...), " ")
+}
+
+// ssh returns the ssh command line connecting to the remote host
+func (s *SSHBuilder) ssh() string {
+	return s.sshCommand() + " " + shellQuote(s.destination())
+}
@@ -0,0 +1,30 @@
+package builder
+
+import "testing"
+
+func TestSSHBuilder(t *testing.T) {
+	conf := testConfig(map[string]string{
+		"builder.ssh.host": "example.com",
+		"builder.ssh.user": "deploy",
+	})
+	dropletfile := `STAGE install
+COPY a.txt /srv/
+COPY ["b c.txt", "/srv/b c.txt"]
+RUN echo done
+`
+	script := buildTestScript(t, conf, "ssh", dropletfile)
+	assertGolden(t, "ssh", script)
+	assertBashSyntax(t, script)
+}
+
+func TestSSHBuilderStaging(t *testing.T) {
+	for _, staging := range []string{"", "/", "tmp/droplet", "/tmp/my droplet"} {
+		conf := testConfig(map[string]string{
+			"builder.ssh.host":    "example.com",
+			"builder.ssh.staging": staging,
+		})
+		if _, err := NewSSHBuilder(conf); err == nil {
+			t.Errorf("staging dir %q: expected an error", staging)
+		}
+	}
+}
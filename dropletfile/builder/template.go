@@ -0,0 +1,53 @@
+package builder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigData is the data CONFIG templates are rendered with, the values are
+// the ones declared before the CONFIG instruction in the stage:
+//
+//	listen {{ .Env.PORT }};
+//	server_name {{ .Args.DOMAIN }};
+type ConfigData struct {
+	Stage  string
+	Args   map[string]string
+	Env    map[string]string
+	Labels map[string]string
+}
+
+// renderConfig renders a template file of the build context
+func renderConfig(contextDir string, name string, data ConfigData) ([]byte, error) {
+	if contextDir == "" {
+		contextDir = "."
+	}
+
+	file := filepath.Join(contextDir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(contextDir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errors.Errorf("CONFIG template %s is outside of the build context", name)
+	}
+
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CONFIG template")
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse CONFIG template")
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, errors.Wrap(err, "failed to render CONFIG template")
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,61 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestRenderConfig(t *testing.T) {
+	data := ConfigData{
+		Stage: "install",
+		Args:  map[string]string{"VERSION": "1.0"},
+		Env:   map[string]string{"APP_HOME": "/srv/app"},
+	}
+	res, err := renderConfig(testContext, "app.conf.tmpl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "stage install\nversion 1.0\nhome /srv/app\n"; string(res) != expected {
+		t.Errorf("expected %q, got %q", expected, res)
+	}
+}
+
+func TestRenderConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     ConfigData
+		expected string
+	}{
+		{"app.conf.tmpl", ConfigData{Stage: "install", Args: map[string]string{"VERSION": "1.0"}, Env: map[string]string{}}, `map has no entry for key "APP_HOME"`},
+		{"../x", ConfigData{}, "CONFIG template ../x is outside of the build context"},
+		{"sub/../../x", ConfigData{}, "CONFIG template sub/../../x is outside of the build context"},
+		{"missing.tmpl", ConfigData{}, "failed to read CONFIG template"},
+	}
+	for _, test := range tests {
+		_, err := renderConfig(testContext, test.name, test.data)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected the error %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+// TestConfigTemplate renders a CONFIG with the args, the env and the stage
+// declared before it, the build args override the ARG defaults
+func TestConfigTemplate(t *testing.T) {
+	dropletfile := "STAGE install\nARG VERSION=1.0\nENV APP_HOME=/srv/app\nCONFIG app.conf.tmpl /etc/app.conf\n"
+	script, err := buildTest(testConfig(nil), "local", dropletfile, map[string]string{"VERSION": "2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := script.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	content := base64.StdEncoding.EncodeToString([]byte("stage install\nversion 2.0\nhome /srv/app\n"))
+	if !strings.Contains(buf.String(), "echo "+content+" | base64 -d") {
+		t.Errorf("expected the rendered template with the build arg\n%s", buf.String())
+	}
+}
@@ -0,0 +1,122 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+)
+
+// createUser builds the commands creating the user and group of a USER
+// instruction when they don't exist, busybox adduser is used on Alpine. With
+// the auto package manager, adduser is used when useradd isn't found.
+func (l *LocalBuilder) createUser(command instructions.UserCommand) string {
+	if !command.Create {
+		return ""
+	}
+
+	switch l.conf.Get("package_manager") {
+	case "apk":
+		return l.addUser(command, true)
+	case autoPackageManager:
+		return fmt.Sprintf("if command -v %s >/dev/null 2>&1; then %s; else %s; fi",
+			l.conf.Get("builder.local.useradd"), l.addUser(command, false), l.addUser(command, true))
+	default:
+		return l.addUser(command, false)
+	}
+}
+
+func (l *LocalBuilder) addUser(command instructions.UserCommand, busybox bool) string {
+	user, group := command.UserAndGroup()
+
+	cmd := []string{}
+	if group != "" && !reNumeric.MatchString(group) {
+		groupadd := l.conf.Get("builder.local.groupadd")
+		if busybox {
+			groupadd = l.conf.Get("builder.local.addgroup")
+		}
+		cmd = append(cmd, fmt.Sprintf("{ getent group %s >/dev/null || %s %s; }", shellQuote(group), groupadd, shellQuote(group)))
+	}
+
+	var args []string
+	if busybox {
+		args = []string{l.conf.Get("builder.local.adduser"), "-D"}
+		args = appendFlag(args, "-u", command.UID)
+		args = appendFlag(args, "-h", command.Home)
+		args = appendFlag(args, "-s", command.Shell)
+		args = appendFlag(args, "-G", group)
+	} else {
+		args = []string{l.conf.Get("builder.local.useradd"), "-m"}
+		args = appendFlag(args, "-u", command.UID)
+		args = appendFlag(args, "-d", command.Home)
+		args = appendFlag(args, "-s", command.Shell)
+		args = appendFlag(args, "-g", group)
+	}
+	args = append(args, shellQuote(user))
+	cmd = append(cmd, fmt.Sprintf("{ id -u %s >/dev/null 2>&1 || %s; }", shellQuote(user), strings.Join(args, " ")))
+
+	return andThen(cmd...)
+}
+
+// checkUser builds the commands failing the build when the user or group of
+// a USER instruction doesn't exist
+func (l *LocalBuilder) checkUser(command instructions.UserCommand) string {
+	user, group := command.UserAndGroup()
+	cmd := []string{fmt.Sprintf("id -u %s >/dev/null", shellQuote(user))}
+	if group != "" {
+		cmd = append(cmd, fmt.Sprintf("getent group %s >/dev/null", shellQuote(group)))
+	}
+	return andThen(cmd...)
+}
+
+// owner returns the owner of copied files, the one of --chown or else the
+// user and group of the last USER instruction
+func (l *LocalBuilder) owner(chown string) string {
+	if chown != "" || l.user == "" {
+		return chown
+	}
+	if l.group != "" {
+		return l.user + ":" + l.group
+	}
+	return l.user
+}
+
+// runAs runs a simple command line as the user of the last USER instruction,
+// su is used on Alpine where busybox has no runuser. With the auto package
+// manager, su is used when runuser isn't found.
+func (l *LocalBuilder) runAs(cmd string) string {
+	if cmd == "" || l.user == "" {
+		return cmd
+	}
+
+	switch l.conf.Get("package_manager") {
+	case "apk":
+		return l.su(cmd)
+	case autoPackageManager:
+		return fmt.Sprintf("if command -v %s >/dev/null 2>&1; then %s; else %s; fi",
+			l.conf.Get("builder.local.runas"), l.runuser(cmd), l.su(cmd))
+	default:
+		return l.runuser(cmd)
+	}
+}
+
+func (l *LocalBuilder) runuser(cmd string) string {
+	args := []string{l.conf.Get("builder.local.runas"), "-u", shellQuote(l.user)}
+	args = appendFlag(args, "-g", l.group)
+	return strings.Join(append(args, "--", cmd), " ")
+}
+
+// su runs the command with the shell of su, its words are passed as args so
+// that the script still expands them. su can't switch the group, the command
+// runs with the primary group of the user.
+func (l *LocalBuilder) su(cmd string) string {
+	return fmt.Sprintf(`%s -s /bin/sh -c 'exec "$0" "$@"' %s %s`, l.conf.Get("builder.local.user"), shellQuote(l.user), cmd)
+}
+
+// appendFlag appends a flag and its quoted value when the value is set
+func appendFlag(args []string, flag string, value string) []string {
+	if value == "" {
+		return args
+	}
+	return append(args, flag, shellQuote(value))
+}
@@ -0,0 +1,109 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// userDropletfile switches to a user, only RUN and COPY run as that user
+const userDropletfile = `STAGE install
+ARG NAME=droplet
+USER --create --uid=1000 --home=/srv/app app:app
+WORKDIR /srv/app
+RUN echo "$NAME" > name
+RUN ["id", "-u"]
+COPY a.txt data/
+PACKAGE curl
+CONFIG a.txt /etc/app.conf
+USER root
+RUN id -u
+`
+
+func TestUser(t *testing.T) {
+	builders := []struct {
+		name    string
+		builder string
+		configs map[string]string
+	}{
+		{"user-local-apk", "local", map[string]string{"package_manager": "apk"}},
+		{"user-local-apt", "local", map[string]string{"package_manager": "apt"}},
+		{"user-local-auto", "local", map[string]string{"package_manager": "auto"}},
+		{"user-docker", "docker", map[string]string{"package_manager": "apk", "builder.docker.container": "web"}},
+		{"user-dockerfile", "dockerfile", map[string]string{"package_manager": "apk"}},
+		{"user-lxd", "lxd", map[string]string{"package_manager": "apk"}},
+	}
+
+	for _, test := range builders {
+		t.Run(test.name, func(t *testing.T) {
+			script := buildTestScript(t, testConfig(test.configs), test.builder, userDropletfile)
+			assertGolden(t, test.name, script)
+			if test.builder != "dockerfile" {
+				assertBashSyntax(t, script)
+			}
+		})
+	}
+}
+
+func TestUserSu(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	dir, err := ioutil.TempDir("", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// su -s shell -c command user arg0 args runs the command with the args
+	su := filepath.Join(dir, "su")
+	script := "#!/bin/sh\nshell=$2 command=$4\nshift 5\nexec \"$shell\" -c \"$command\" \"$@\"\n"
+	if err := ioutil.WriteFile(su, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := testConfig(map[string]string{"package_manager": "apk", "builder.local.user": su})
+	dropletfile := `STAGE install
+ARG NAME="a b"
+USER ` + current.Username + `
+RUN echo "$NAME" > ` + filepath.Join(dir, "shell") + `
+RUN ["cp", "` + filepath.Join(testContext, "a.txt") + `", "` + filepath.Join(dir, "exec") + `"]
+COPY ["b c.txt", "` + dir + `/"]
+`
+	cmd := exec.Command(bash, "-c", buildTestScript(t, conf, "local", dropletfile))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	for name, expected := range map[string]string{"shell": "a b", "exec": "hello", "b c.txt": "x y"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if strings.TrimSpace(string(content)) != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, content)
+		}
+	}
+}
+
+func TestDockerfileUserSwitchBack(t *testing.T) {
+	dropletfile := "STAGE install\nUSER app\nPACKAGE curl\n"
+	script := buildTestScript(t, testConfig(map[string]string{"package_manager": "apk"}), "dockerfile", dropletfile)
+	if !strings.Contains(script, "\nUSER root\nRUN ") {
+		t.Errorf("expected PACKAGE to run as root\n%s", script)
+	}
+	if !strings.HasSuffix(script, "\nUSER app\n") {
+		t.Errorf("expected the image to switch back to app\n%s", script)
+	}
+}
@@ -0,0 +1,31 @@
+package builder
+
+import (
+	"path"
+
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+)
+
+// resolvePaths resolves the relative paths of a command against the working
+// dir of the stage, and returns the working dir once the command ran. Paths
+// are only rewritten once an absolute WORKDIR is known, before that they are
+// relative to the dir the script runs in.
+func resolvePaths(workdir string, c instructions.Command) string {
+	switch cmd := c.(type) {
+	case *instructions.WorkdirCommand:
+		cmd.Resolved = instructions.ResolvePath(workdir, cmd.Path)
+		return cmd.Resolved
+	case *instructions.CopyCommand:
+		if path.IsAbs(workdir) {
+			last := len(cmd.SourcesAndDest) - 1
+			cmd.SourcesAndDest[last] = instructions.ResolvePath(workdir, cmd.SourcesAndDest[last])
+		}
+	case *instructions.DeleteCommand:
+		if path.IsAbs(workdir) {
+			for i, p := range cmd.SourcesAndDest {
+				cmd.SourcesAndDest[i] = instructions.ResolvePath(workdir, p)
+			}
+		}
+	}
+	return workdir
+}
@@ -0,0 +1,24 @@
+package builder
+
+import "testing"
+
+func TestWorkdir(t *testing.T) {
+	dropletfile := `STAGE install
+WORKDIR build
+COPY a.txt conf/
+WORKDIR /srv
+WORKDIR app
+COPY a.txt conf/
+COPY a.txt /etc/app/
+DELETE cache tmp/ /var/cache/app
+WORKDIR ../data
+RUN pwd
+
+STAGE update --depends=install
+WORKDIR app
+RUN pwd
+`
+	script := buildTestScript(t, testConfig(nil), "local", dropletfile)
+	assertGolden(t, "workdir", script)
+	assertBashSyntax(t, script)
+}
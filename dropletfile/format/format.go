@@ -0,0 +1,207 @@
+// Package format implements the canonical formatting of Dropletfiles.
+package format
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/getopendroplet/droplet/dropletfile/parser"
+)
+
+// Indent is the indentation of continuation lines
+const Indent = "    "
+
+var utf8bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Format returns the canonical formatting of a Dropletfile:
+//
+//   - instruction keywords are upper-cased
+//   - the flags of an instruction are sorted by name
+//   - continuation lines are indented with Indent
+//   - trailing spaces and repeated blank lines are removed
+//
+// Comments and parser directives are kept as they are.
+func Format(src []byte) ([]byte, error) {
+	result, err := parser.Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+
+	src = bytes.TrimPrefix(src, utf8bom)
+	lines := strings.Split(strings.Replace(string(src), "\r\n", "\n", -1), "\n")
+
+	f := &formatter{escapeToken: result.EscapeToken}
+	line := 0
+	for _, node := range result.AST.Children {
+		// Comments and blank lines preceding the instruction
+		for ; line < node.StartLine-1; line++ {
+			f.writeLine(strings.TrimSpace(lines[line]))
+		}
+
+		f.writeInstruction(lines[node.StartLine-1 : node.EndLine])
+		line = node.EndLine
+	}
+	for ; line < len(lines); line++ {
+		f.writeLine(strings.TrimSpace(lines[line]))
+	}
+
+	return f.buf.Bytes(), nil
+}
+
+type formatter struct {
+	buf         bytes.Buffer
+	escapeToken rune
+	blank       bool
+}
+
+// writeLine writes a line, collapsing repeated blank lines
+func (f *formatter) writeLine(line string) {
+	if line == "" {
+		f.blank = f.buf.Len() > 0
+		return
+	}
+	if f.blank {
+		f.buf.WriteString("\n")
+		f.blank = false
+	}
+	f.buf.WriteString(line + "\n")
+}
+
+func (f *formatter) writeInstruction(lines []string) {
+	first := strings.TrimRightFunc(lines[0], unicode.IsSpace)
+	f.writeLine(f.formatFirstLine(strings.TrimLeftFunc(first, unicode.IsSpace)))
+
+	prev := first
+	quote := f.quoteState(0, first)
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			// Empty continuation lines are ignored by the parser
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			f.writeLine(Indent + trimmed)
+			continue
+		}
+
+		// The leading spaces of a continuation line are part of the
+		// instruction, a line glued to the previous one or continuing a
+		// quoted string is left as it is
+		if quote != 0 || (!f.endsWithSpace(prev) && !startsWithSpace(line)) {
+			f.writeLine(strings.TrimRightFunc(line, unicode.IsSpace))
+		} else {
+			f.writeLine(Indent + trimmed)
+		}
+		prev = line
+		quote = f.quoteState(quote, line)
+	}
+}
+
+// formatFirstLine upper-cases the keyword and sorts the flags of the first
+// line of an instruction
+func (f *formatter) formatFirstLine(line string) string {
+	i := strings.IndexFunc(line, unicode.IsSpace)
+	if i < 0 {
+		return strings.ToUpper(line)
+	}
+
+	keyword := strings.ToUpper(line[:i])
+	flags, rest := splitFlags(line[i:], f.escapeToken)
+	sort.SliceStable(flags, func(i, j int) bool {
+		return flagName(flags[i]) < flagName(flags[j])
+	})
+
+	words := append([]string{keyword}, flags...)
+	if rest != "" {
+		words = append(words, rest)
+	}
+	return strings.Join(words, " ")
+}
+
+// endsWithSpace returns whether the content of a line preceding its
+// continuation token ends with a space
+func (f *formatter) endsWithSpace(line string) bool {
+	line = strings.TrimRightFunc(line, unicode.IsSpace)
+	line = strings.TrimSuffix(line, string(f.escapeToken))
+	r, _ := utf8.DecodeLastRuneInString(line)
+	return line == "" || unicode.IsSpace(r)
+}
+
+func startsWithSpace(line string) bool {
+	r, _ := utf8.DecodeRuneInString(line)
+	return unicode.IsSpace(r)
+}
+
+// splitFlags returns the raw --flag words at the start of s, and the rest of
+// s. A -- word ends the flags and is kept in the rest.
+func splitFlags(s string, escapeToken rune) ([]string, string) {
+	flags := []string{}
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if !strings.HasPrefix(s, "--") {
+			return flags, s
+		}
+
+		end := wordEnd(s, escapeToken)
+		if s[:end] == "--" {
+			return flags, s
+		}
+		flags = append(flags, s[:end])
+		s = s[end:]
+	}
+}
+
+// quoteState returns the quote still open at the end of line, quote being
+// the quote open at its start
+func (f *formatter) quoteState(quote rune, line string) rune {
+	escaped := false
+	for _, ch := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == f.escapeToken && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		}
+	}
+	return quote
+}
+
+// wordEnd returns the end of the first word of s, spaces between quotes are
+// part of the word
+func wordEnd(s string, escapeToken rune) int {
+	quote := rune(0)
+	escaped := false
+	for i, ch := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == escapeToken && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case unicode.IsSpace(ch):
+			return i
+		}
+	}
+	return len(s)
+}
+
+func flagName(flag string) string {
+	if i := strings.Index(flag, "="); i >= 0 {
+		flag = flag[:i]
+	}
+	return strings.ToLower(flag)
+}
@@ -0,0 +1,123 @@
+package format
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/getopendroplet/droplet/dropletfile/parser"
+)
+
+var formatTests = []struct {
+	name     string
+	src      string
+	expected string
+}{
+	{
+		"keywords",
+		"stage install\nrun echo hello\nCopy a b\n",
+		"STAGE install\nRUN echo hello\nCOPY a b\n",
+	},
+	{
+		"flags",
+		"COPY --chown=app --chmod=640 a b\nPACKAGE --Manager=pip --action=install flask\nRUN -- --not-a-flag\n",
+		"COPY --chmod=640 --chown=app a b\nPACKAGE --action=install --Manager=pip flask\nRUN -- --not-a-flag\n",
+	},
+	{
+		"spaces",
+		"  RUN echo a   \n\n\n\n# comment  \n\t\nRUN echo b\n\n",
+		"RUN echo a\n\n# comment\n\nRUN echo b\n",
+	},
+	{
+		"continuations",
+		"RUN apt update && \\\n        apt install curl \\\n  && apt clean\n",
+		"RUN apt update && \\\n    apt install curl \\\n    && apt clean\n",
+	},
+	{
+		"glued continuation",
+		"RUN echo hel\\\nlo\n",
+		"RUN echo hel\\\nlo\n",
+	},
+	{
+		"quoted continuation",
+		"RUN echo 'a \\\n   b'\n",
+		"RUN echo 'a \\\n   b'\n",
+	},
+	{
+		"comment in continuation",
+		"RUN echo a \\\n# comment\n  b\n",
+		"RUN echo a \\\n    # comment\n    b\n",
+	},
+	{
+		"escape directive",
+		"# escape=`\nrun echo a `\n   b\n",
+		"# escape=`\nRUN echo a `\n    b\n",
+	},
+	{
+		"crlf and bom",
+		"\xEF\xBB\xBFrun echo a\r\nrun echo b\r\n",
+		"RUN echo a\nRUN echo b\n",
+	},
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range formatTests {
+		res, err := Format([]byte(test.src))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if string(res) != test.expected {
+			t.Errorf("%s: expected\n%q\ngot\n%q", test.name, test.expected, res)
+		}
+	}
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	sample, err := ioutil.ReadFile("../../Dropletfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{"Dropletfile": string(sample)}
+	for _, test := range formatTests {
+		sources[test.name] = test.src
+	}
+
+	for name, src := range sources {
+		once, err := Format([]byte(src))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+			continue
+		}
+		twice, err := Format(once)
+		if err != nil {
+			t.Errorf("%s: unexpected error formatting again %v", name, err)
+			continue
+		}
+		if !bytes.Equal(once, twice) {
+			t.Errorf("%s: formatting again changed\n%s\ninto\n%s", name, once, twice)
+		}
+
+		// Formatting doesn't change the instructions
+		if dump(t, []byte(src)) != dump(t, once) {
+			t.Errorf("%s: formatting changed the instructions\n%s\ninto\n%s", name, dump(t, []byte(src)), dump(t, once))
+		}
+	}
+}
+
+// dump returns the instructions of a Dropletfile with their flags sorted, the
+// spaces separating the words of a shell command are collapsed
+func dump(t *testing.T, src []byte) string {
+	t.Helper()
+
+	result, err := parser.Parse(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range result.AST.Children {
+		sort.Strings(node.Flags)
+	}
+	return strings.Join(strings.Fields(result.AST.Dump()), " ")
+}
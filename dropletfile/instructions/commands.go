@@ -1,9 +1,11 @@
 package instructions
 
 import (
+	"path"
 	"strings"
 
 	"github.com/getopendroplet/droplet/dropletfile/parser"
+	"github.com/getopendroplet/droplet/dropletfile/shell"
 
 	"github.com/pkg/errors"
 )
@@ -150,10 +152,36 @@ func (c *ArgCommand) Expand(expander SingleWordExpander) error {
 	return nil
 }
 
-// ConfigCommand : CONFIG /etc/nginx /etc/hosts
+// ConfigCommand : CONFIG [--mode=0644] [--owner=root:root] nginx.conf /etc/nginx/
+//
+// The source is a text/template file of the build context, rendered when the
+// script is built.
 type ConfigCommand struct {
 	withNameAndCode
-	Configs []string
+	SourcesAndDest
+	Mode    string
+	Owner   string
+	Content []byte `json:"-"` // rendered template, set at build time
+}
+
+// Template returns the name of the template file
+func (c *ConfigCommand) Template() string {
+	return c.Sources()[0]
+}
+
+// Expand variables
+func (c *ConfigCommand) Expand(expander SingleWordExpander) error {
+	expandedMode, err := expander(c.Mode)
+	if err != nil {
+		return err
+	}
+	c.Mode = expandedMode
+	expandedOwner, err := expander(c.Owner)
+	if err != nil {
+		return err
+	}
+	c.Owner = expandedOwner
+	return expandSliceInPlace(c.SourcesAndDest, expander)
 }
 
 // CopyCommand : COPY foo /path
@@ -171,10 +199,22 @@ func (c *CopyCommand) Expand(expander SingleWordExpander) error {
 		return err
 	}
 	c.Chown = expandedChown
+	expandedChmod, err := expander(c.Chmod)
+	if err != nil {
+		return err
+	}
+	c.Chmod = expandedChmod
 	return expandSliceInPlace(c.SourcesAndDest, expander)
 }
 
-// CronCommand : CRON * * * * * df -h
+// CRON actions
+const (
+	CronInstall = "install"
+	CronRemove  = "remove"
+)
+
+// CronCommand : CRON [--user=root] [--name=backup] [--action=install] * * * * * df -h
+// or CRON @daily df -h
 type CronCommand struct {
 	withNameAndCode
 	Minute        string
@@ -182,13 +222,44 @@ type CronCommand struct {
 	DayOfTheMonth string
 	Month         string
 	DayOfTheWeek  string
+	Macro         string // @daily like schedule replacing the five fields
+	User          string
+	EntryName     string // identifies the entry, defaults to a hash of the command
+	Action        string // install or remove, defaults to remove in the remove stage
 	ShellDependantCmdLine
 }
 
-// DeleteCommand : DELETE /path
+// Schedule returns the schedule of the crontab entry
+func (c *CronCommand) Schedule() string {
+	if c.Macro != "" {
+		return c.Macro
+	}
+	return strings.Join([]string{c.Minute, c.Hour, c.DayOfTheMonth, c.Month, c.DayOfTheWeek}, " ")
+}
+
+// Expand variables
+func (c *CronCommand) Expand(expander SingleWordExpander) error {
+	for _, value := range []*string{&c.User, &c.EntryName, &c.Action} {
+		expanded, err := expander(*value)
+		if err != nil {
+			return err
+		}
+		*value = expanded
+	}
+	return nil
+}
+
+// DeleteCommand : DELETE [--force] [--dry-run] /path
 type DeleteCommand struct {
 	withNameAndCode
 	SourcesAndDest
+	Force  bool
+	DryRun bool
+}
+
+// Expand variables
+func (c *DeleteCommand) Expand(expander SingleWordExpander) error {
+	return expandSliceInPlace(c.SourcesAndDest, expander)
 }
 
 // EnvCommand : ENV key1 value1 [keyN valueN...]
@@ -202,10 +273,42 @@ func (c *EnvCommand) Expand(expander SingleWordExpander) error {
 	return expandKvpsInPlace(c.Env, expander)
 }
 
-// ExposeCommand : EXPOSE 6667/tcp 7000/tcp
+// ExposeCommand : EXPOSE [--from=10.0.0.0/8] 6667/tcp 7000-7010/udp
 type ExposeCommand struct {
 	withNameAndCode
 	Ports []string
+	From  string
+}
+
+// Expand variables
+func (c *ExposeCommand) Expand(expander SingleWordExpander) error {
+	expandedFrom, err := expander(c.From)
+	if err != nil {
+		return err
+	}
+	c.From = expandedFrom
+	return expandSliceInPlace(c.Ports, expander)
+}
+
+// PortSpecs returns the typed ports, the source of the instruction applies to
+// all of them
+func (c *ExposeCommand) PortSpecs() ([]PortSpec, error) {
+	if c.From != "" {
+		if err := validateSource(c.From); err != nil {
+			return nil, err
+		}
+	}
+
+	specs := make([]PortSpec, len(c.Ports))
+	for i, port := range c.Ports {
+		spec, err := ParsePortSpec(port)
+		if err != nil {
+			return nil, err
+		}
+		spec.Source = c.From
+		specs[i] = spec
+	}
+	return specs, nil
 }
 
 // LabelCommand : LABEL some json data describing the image
@@ -223,21 +326,99 @@ func (c *LabelCommand) Expand(expander SingleWordExpander) error {
 	return expandKvpsInPlace(c.Labels, expander)
 }
 
-// PackageCommand : PACKAGE nginx
+// Actions of a PACKAGE instruction
+const (
+	PackageInstall = "install"
+	PackageRemove  = "remove"
+	PackageUpdate  = "update"
+	PackageUpgrade = "upgrade"
+	PackageClean   = "clean"
+)
+
+// PackageActions are the actions of a PACKAGE instruction, and whether they
+// take packages
+var PackageActions = map[string]bool{
+	PackageInstall: true,
+	PackageRemove:  true,
+	PackageUpdate:  false,
+	PackageUpgrade: false,
+	PackageClean:   false,
+}
+
+// ValidatePackageAction checks the action of a PACKAGE instruction
+func ValidatePackageAction(action string, packages []string) error {
+	needsPackages, ok := PackageActions[action]
+	if !ok {
+		return errors.Errorf("invalid PACKAGE action %q, expected one of %s, %s, %s, %s or %s", action, PackageInstall, PackageRemove, PackageUpdate, PackageUpgrade, PackageClean)
+	}
+	if needsPackages && len(packages) == 0 {
+		return errors.Errorf("PACKAGE --action=%s requires at least one package", action)
+	}
+	return nil
+}
+
+// PackageCommand : PACKAGE [--action=install] [--map=apt:php-fpm,apk:php7] nginx@1.18 php
+// or PACKAGE --manager=pip [--target=/opt/app/venv] requests@2.31
 type PackageCommand struct {
 	withNameAndCode
 	Action   string
 	Packages []string
+	Map      PackageMap
+	Manager  string // package manager of the instruction, defaults to the package_manager config
+	Target   string // dir the packages are installed to, like a virtualenv
 }
 
+// PackageMap maps a package to its name for a package manager
+type PackageMap map[string]map[string]string
+
 // Expand variables
 func (c *PackageCommand) Expand(expander SingleWordExpander) error {
-	action, err := expander(c.Action)
-	if err != nil {
+	for _, value := range []*string{&c.Action, &c.Manager, &c.Target} {
+		expanded, err := expander(*value)
+		if err != nil {
+			return err
+		}
+		*value = expanded
+	}
+	if err := expandSliceInPlace(c.Packages, expander); err != nil {
 		return err
 	}
-	c.Action = action
-	return expandSliceInPlace(c.Packages, expander)
+	for _, p := range c.Packages {
+		if _, _, err := SplitPackage(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Package returns the name and version of a package for a package manager,
+// the name may be mapped by --map or by the package alias file, the mapped
+// name keeps the version unless it has its own
+func (c *PackageCommand) Package(p string, manager string) (string, string) {
+	name, version, _ := SplitPackage(p)
+	mapped, ok := c.Map[name][manager]
+	if !ok {
+		return name, version
+	}
+
+	mappedName, mappedVersion, _ := SplitPackage(mapped)
+	if mappedVersion == "" {
+		mappedVersion = version
+	}
+	return mappedName, mappedVersion
+}
+
+// SplitPackage splits a package like nginx@1.18 into its name and version,
+// the version is empty when not pinned
+func SplitPackage(p string) (string, string, error) {
+	i := strings.LastIndex(p, "@")
+	if i <= 0 {
+		return p, "", nil
+	}
+	if i == len(p)-1 {
+		return "", "", errors.Errorf("invalid PACKAGE %q, expected a version after @", p)
+	}
+	return p[:i], p[i+1:], nil
 }
 
 // ShellDependantCmdLine represents a cmdline optionally prepended with the shell
@@ -246,6 +427,37 @@ type ShellDependantCmdLine struct {
 	PrependShell bool
 }
 
+// Actions of a REPOSITORY instruction
+const (
+	RepositoryAdd    = "add"
+	RepositoryRemove = "remove"
+)
+
+// RepositoryCommand : REPOSITORY [--name=nginx] [--key=https://nginx.org/keys/nginx_signing.key]
+// [--suite=bookworm] [--components=nginx] [--action=add] https://nginx.org/packages/debian
+// or REPOSITORY homebrew/cask for brew
+type RepositoryCommand struct {
+	withNameAndCode
+	URL            string
+	RepositoryName string // names the repository file, defaults to one made of the URL
+	Key            string // URL of the signing key
+	Suite          string
+	Components     []string
+	Action         string // add or remove, defaults to remove in the remove stage
+}
+
+// Expand variables
+func (c *RepositoryCommand) Expand(expander SingleWordExpander) error {
+	for _, value := range []*string{&c.URL, &c.RepositoryName, &c.Key, &c.Suite, &c.Action} {
+		expanded, err := expander(*value)
+		if err != nil {
+			return err
+		}
+		*value = expanded
+	}
+	return expandSliceInPlace(c.Components, expander)
+}
+
 // RunCommand : RUN some command yo
 type RunCommand struct {
 	withNameAndCode
@@ -256,6 +468,7 @@ type RunCommand struct {
 // Stage represents a single stage in a multi-stage build
 type Stage struct {
 	Name       string
+	Depends    []string
 	Commands   []Command
 	SourceCode string
 	Location   []parser.Range
@@ -295,26 +508,118 @@ func HasStage(s []Stage, name string) (int, bool) {
 	return -1, false
 }
 
-// UserCommand : USER foo
+// ResolveStages returns the named stages and the stages they depend on, with
+// every stage placed after its dependencies.
+func ResolveStages(s []Stage, names []string) ([]Stage, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	res := []Stage{}
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		index, exists := HasStage(s, name)
+		if !exists {
+			return errors.Errorf("no build stage %s in current Dropletfile", name)
+		}
+		stage := s[index]
+
+		switch state[stage.Name] {
+		case visiting:
+			// The cycle starts at the first visit of the repeated stage
+			start := 0
+			for start < len(path) && path[start] != stage.Name {
+				start++
+			}
+			cycle := append(append([]string{}, path[start:]...), stage.Name)
+			return parser.WithLocation(errors.Errorf("dropletfile stage error line %d: dependency cycle %s", stage.Location[0].Start.Line, strings.Join(cycle, " -> ")), stage.Location)
+		case visited:
+			return nil
+		}
+
+		state[stage.Name] = visiting
+		path = append(append([]string{}, path...), stage.Name)
+		for _, dep := range stage.Depends {
+			if _, exists := HasStage(s, dep); !exists {
+				return parser.WithLocation(errors.Errorf("dropletfile stage error line %d: stage %s depends on unknown stage %s", stage.Location[0].Start.Line, stage.Name, dep), stage.Location)
+			}
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[stage.Name] = visited
+
+		res = append(res, stage)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// UserCommand : USER [--create] [--uid=1000] [--home=/home/foo] [--shell=/bin/sh] foo[:group]
 type UserCommand struct {
 	withNameAndCode
-	User string
+	User   string
+	Create bool
+	UID    string
+	Home   string
+	Shell  string
 }
 
 // Expand variables
 func (c *UserCommand) Expand(expander SingleWordExpander) error {
-	p, err := expander(c.User)
-	if err != nil {
-		return err
+	for _, value := range []*string{&c.User, &c.UID, &c.Home, &c.Shell} {
+		p, err := expander(*value)
+		if err != nil {
+			return err
+		}
+		*value = p
 	}
-	c.User = p
 	return nil
 }
 
+// UserAndGroup splits the user and the optional group
+func (c *UserCommand) UserAndGroup() (string, string) {
+	if i := strings.Index(c.User, ":"); i >= 0 {
+		return c.User[:i], c.User[i+1:]
+	}
+	return c.User, ""
+}
+
+// IsRoot returns whether the instruction switches back to root
+func (c *UserCommand) IsRoot() bool {
+	user, group := c.UserAndGroup()
+	return (user == "root" || user == "0") && (group == "" || group == "root" || group == "0")
+}
+
 // WorkdirCommand : WORKDIR /tmp
 type WorkdirCommand struct {
 	withNameAndCode
-	Path string
+	Path     string
+	Resolved string // Path resolved against the previous WORKDIR of the stage
+}
+
+// ResolvePath resolves a relative path against the working dir dir, the path
+// stays relative while no absolute WORKDIR is known. A path starting with a
+// variable left for the target is kept as is.
+func ResolvePath(dir string, p string) string {
+	if p == "" || dir == "" || path.IsAbs(p) || shell.StartsWithRef(p) {
+		return p
+	}
+
+	res := path.Join(dir, p)
+	if strings.HasSuffix(p, "/") && res != "/" {
+		res += "/"
+	}
+	return res
 }
 
 // Expand variables
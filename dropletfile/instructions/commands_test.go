@@ -0,0 +1,53 @@
+package instructions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getopendroplet/droplet/dropletfile/parser"
+	"github.com/getopendroplet/droplet/dropletfile/shell"
+)
+
+func TestResolvePath(t *testing.T) {
+	tests := []struct {
+		dir, path, expected string
+	}{
+		{"/srv", "app", "/srv/app"},
+		{"/srv", "app/", "/srv/app/"},
+		{"/srv", "./app/../data", "/srv/data"},
+		{"/srv", "..", "/"},
+		{"/srv", "../", "/"},
+		{"/srv", "/etc", "/etc"},
+		{"/srv", "", ""},
+		{"", "app", "app"},
+		{"app", "data", "app/data"},
+		{"/srv", shell.Ref("HOME") + "/app", shell.Ref("HOME") + "/app"},
+		{"/srv", "app-" + shell.Ref("VERSION"), "/srv/app-" + shell.Ref("VERSION")},
+	}
+	for _, test := range tests {
+		if res := ResolvePath(test.dir, test.path); res != test.expected {
+			t.Errorf("%q, %q: expected %q, got %q", test.dir, test.path, test.expected, res)
+		}
+	}
+}
+
+func TestResolveStagesCycle(t *testing.T) {
+	dropletfile := `STAGE install --depends=configure
+STAGE configure --depends=update
+STAGE update --depends=configure
+`
+	result, err := parser.Parse(strings.NewReader(dropletfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages, _, err := Parse(result.AST)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// install depends on the cycle without being part of it
+	_, err = ResolveStages(stages, []string{"install"})
+	if err == nil || !strings.HasSuffix(err.Error(), "dependency cycle configure -> update -> configure") {
+		t.Errorf("expected the cycle from configure, got %v", err)
+	}
+}
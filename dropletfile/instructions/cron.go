@@ -0,0 +1,97 @@
+package instructions
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CronMonths are the names allowed in the month field of a CRON schedule
+var CronMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// CronWeekdays are the names allowed in the day of the week field of a CRON
+// schedule, sunday is 0
+var CronWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// CronMacros are the schedules which can replace the five fields
+var CronMacros = map[string]struct{}{
+	"@reboot":   {},
+	"@yearly":   {},
+	"@annually": {},
+	"@monthly":  {},
+	"@weekly":   {},
+	"@daily":    {},
+	"@midnight": {},
+	"@hourly":   {},
+}
+
+var reCronName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of the month", 1, 31, nil},
+	{"month", 1, 12, CronMonths},
+	{"day of the week", 0, 7, CronWeekdays},
+}
+
+// validateCronSchedule checks the five fields of a CRON schedule
+func validateCronSchedule(schedule []string) error {
+	for i, f := range cronFields {
+		if !f.valid(schedule[i]) {
+			return errors.Errorf("invalid CRON %s %q, expected values between %d and %d", f.name, schedule[i], f.min, f.max)
+		}
+	}
+	return nil
+}
+
+// valid checks a field made of comma separated *, values or ranges,
+// optionally followed by a /step
+func (f cronField) valid(field string) bool {
+	for _, item := range strings.Split(field, ",") {
+		if i := strings.Index(item, "/"); i >= 0 {
+			step, err := strconv.Atoi(item[i+1:])
+			if err != nil || step < 1 || step > f.max {
+				return false
+			}
+			item = item[:i]
+		}
+
+		if item == "*" {
+			continue
+		}
+
+		bounds := strings.SplitN(item, "-", 2)
+		start, ok := f.value(bounds[0])
+		if !ok {
+			return false
+		}
+		if len(bounds) == 2 {
+			end, ok := f.value(bounds[1])
+			if !ok || end < start {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (f cronField) value(s string) (int, bool) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, true
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n >= f.min && n <= f.max
+}
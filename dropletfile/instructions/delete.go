@@ -0,0 +1,75 @@
+package instructions
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SystemDirs are the top-level dirs DELETE only removes with --force
+var SystemDirs = map[string]struct{}{
+	"/bin":   {},
+	"/boot":  {},
+	"/dev":   {},
+	"/etc":   {},
+	"/home":  {},
+	"/lib":   {},
+	"/lib32": {},
+	"/lib64": {},
+	"/media": {},
+	"/mnt":   {},
+	"/opt":   {},
+	"/proc":  {},
+	"/root":  {},
+	"/run":   {},
+	"/sbin":  {},
+	"/srv":   {},
+	"/sys":   {},
+	"/tmp":   {},
+	"/usr":   {},
+	"/var":   {},
+}
+
+// ValidateDeletePath rejects the paths DELETE must never remove: the root,
+// empty paths, paths escaping the working dir and, without force, the
+// top-level system dirs
+func ValidateDeletePath(p string, force bool) error {
+	if strings.TrimSpace(p) == "" {
+		return errors.New("DELETE path is empty")
+	}
+
+	clean := path.Clean(p)
+	if clean == "/" {
+		return errors.Errorf("DELETE %s would remove the root dir", p)
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return errors.Errorf("DELETE %s is outside of the working dir", p)
+	}
+	if clean == "." {
+		return errors.Errorf("DELETE %s would remove the working dir", p)
+	}
+	if !path.IsAbs(clean) {
+		return nil
+	}
+
+	top := "/" + strings.SplitN(clean[1:], "/", 2)[0]
+	if strings.ContainsAny(top, "*?[") {
+		if top == clean {
+			return errors.Errorf("DELETE %s matches top-level dirs", p)
+		}
+		if !force {
+			return errors.Errorf("DELETE %s matches top-level dirs, use --force", p)
+		}
+	}
+	if _, ok := SystemDirs[clean]; ok && !force {
+		return errors.Errorf("DELETE %s removes a system dir, use --force", p)
+	}
+	return nil
+}
+
+// IsUnder returns whether the path p is the dir root or is inside of it
+func IsUnder(p string, root string) bool {
+	p, root = path.Clean(p), path.Clean(root)
+	return p == root || root == "/" || strings.HasPrefix(p, root+"/")
+}
@@ -0,0 +1,59 @@
+package instructions
+
+import "testing"
+
+func TestValidateDeletePath(t *testing.T) {
+	tests := []struct {
+		path  string
+		force bool
+		valid bool
+	}{
+		{"/srv/app/cache", false, true},
+		{"cache", false, true},
+		{"cache/../tmp", false, true},
+		{"/var/cache/*", false, true},
+		{"", false, false},
+		{"  ", true, false},
+		{"/", true, false},
+		{"/srv/..", true, false},
+		{"//", true, false},
+		{"..", true, false},
+		{"../cache", true, false},
+		{"cache/../..", true, false},
+		{".", true, false},
+		{"./", true, false},
+		{"/etc", false, false},
+		{"/etc/", false, false},
+		{"/etc", true, true},
+		{"/etc/nginx", false, true},
+		{"/*", true, false},
+		{"/v*", true, false},
+		{"/v*/cache", false, false},
+		{"/v*/cache", true, true},
+	}
+	for _, test := range tests {
+		err := ValidateDeletePath(test.path, test.force)
+		if (err == nil) != test.valid {
+			t.Errorf("%q (force %v): expected valid %v, got %v", test.path, test.force, test.valid, err)
+		}
+	}
+}
+
+func TestIsUnder(t *testing.T) {
+	tests := []struct {
+		path, root string
+		expected   bool
+	}{
+		{"/srv/app", "/srv", true},
+		{"/srv", "/srv", true},
+		{"/srv/", "/srv", true},
+		{"/srvx", "/srv", false},
+		{"/etc", "/srv", false},
+		{"/etc", "/", true},
+	}
+	for _, test := range tests {
+		if res := IsUnder(test.path, test.root); res != test.expected {
+			t.Errorf("%s under %s: expected %v", test.path, test.root, test.expected)
+		}
+	}
+}
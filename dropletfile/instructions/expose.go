@@ -0,0 +1,81 @@
+package instructions
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PortSpec is a port, or a range of ports, exposed by EXPOSE
+type PortSpec struct {
+	Port     int
+	EndPort  int    // last port of a range, 0 for a single port
+	Protocol string // tcp or udp
+	Source   string // address or CIDR allowed to connect, empty for any
+}
+
+// ParsePortSpec parses a port spec like 80, 80/tcp or 8000-8010/udp
+func ParsePortSpec(spec string) (PortSpec, error) {
+	p := PortSpec{Protocol: "tcp"}
+
+	ports := spec
+	if i := strings.Index(spec, "/"); i >= 0 {
+		ports, p.Protocol = spec[:i], strings.ToLower(spec[i+1:])
+	}
+	if p.Protocol != "tcp" && p.Protocol != "udp" {
+		return p, errors.Errorf("invalid EXPOSE protocol in %q, expected tcp or udp", spec)
+	}
+
+	bounds := strings.SplitN(ports, "-", 2)
+	for i, bound := range bounds {
+		n, err := strconv.Atoi(bound)
+		if err != nil || n < 1 || n > 65535 {
+			return p, errors.Errorf("invalid EXPOSE port in %q, expected a port between 1 and 65535", spec)
+		}
+		if i == 0 {
+			p.Port = n
+		} else {
+			p.EndPort = n
+		}
+	}
+	if p.EndPort != 0 && p.EndPort <= p.Port {
+		return p, errors.Errorf("invalid EXPOSE port range %q, the last port must be greater than the first", spec)
+	}
+
+	return p, nil
+}
+
+// validateSource checks the source of an EXPOSE instruction
+func validateSource(source string) error {
+	if net.ParseIP(source) != nil {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(source); err != nil {
+		return errors.Errorf("invalid EXPOSE source %q, expected an address or a CIDR", source)
+	}
+	return nil
+}
+
+// IsRange returns whether the spec is a range of ports
+func (p PortSpec) IsRange() bool {
+	return p.EndPort != 0
+}
+
+// Ports returns the port, or the range of ports joined by sep
+func (p PortSpec) Ports(sep string) string {
+	if p.IsRange() {
+		return strconv.Itoa(p.Port) + sep + strconv.Itoa(p.EndPort)
+	}
+	return strconv.Itoa(p.Port)
+}
+
+// IPv6 returns whether the source is an IPv6 address or network
+func (p PortSpec) IPv6() bool {
+	return strings.Contains(p.Source, ":")
+}
+
+func (p PortSpec) String() string {
+	return p.Ports("-") + "/" + p.Protocol
+}
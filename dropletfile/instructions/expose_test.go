@@ -0,0 +1,56 @@
+package instructions
+
+import "testing"
+
+func TestParsePortSpec(t *testing.T) {
+	tests := map[string]PortSpec{
+		"80":          {Port: 80, Protocol: "tcp"},
+		"80/tcp":      {Port: 80, Protocol: "tcp"},
+		"53/UDP":      {Port: 53, Protocol: "udp"},
+		"8000-8010":   {Port: 8000, EndPort: 8010, Protocol: "tcp"},
+		"1-65535/udp": {Port: 1, EndPort: 65535, Protocol: "udp"},
+	}
+	for spec, expected := range tests {
+		res, err := ParsePortSpec(spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", spec, err)
+			continue
+		}
+		if res != expected {
+			t.Errorf("%s: expected %+v, got %+v", spec, expected, res)
+		}
+	}
+}
+
+func TestParsePortSpecErrors(t *testing.T) {
+	for _, spec := range []string{"", "http", "0", "65536", "80/sctp", "80-", "-80", "90-80", "80-80", "80/tcp/udp"} {
+		if res, err := ParsePortSpec(spec); err == nil {
+			t.Errorf("%s: expected an error, got %+v", spec, res)
+		}
+	}
+}
+
+func TestPortSpec(t *testing.T) {
+	spec := PortSpec{Port: 8000, EndPort: 8010, Protocol: "udp", Source: "2001:db8::/32"}
+	if !spec.IsRange() || spec.Ports(":") != "8000:8010" || spec.String() != "8000-8010/udp" || !spec.IPv6() {
+		t.Errorf("unexpected spec %s", spec)
+	}
+
+	spec = PortSpec{Port: 80, Protocol: "tcp", Source: "10.0.0.0/8"}
+	if spec.IsRange() || spec.Ports(":") != "80" || spec.String() != "80/tcp" || spec.IPv6() {
+		t.Errorf("unexpected spec %s", spec)
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	for _, source := range []string{"10.0.0.1", "10.0.0.0/8", "::1", "2001:db8::/32"} {
+		if err := validateSource(source); err != nil {
+			t.Errorf("%s: unexpected error %v", source, err)
+		}
+	}
+	for _, source := range []string{"example.com", "10.0.0.0/33", "10.0.0"} {
+		if err := validateSource(source); err == nil {
+			t.Errorf("%s: expected an error", source)
+		}
+	}
+}
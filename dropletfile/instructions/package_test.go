@@ -0,0 +1,120 @@
+package instructions
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/getopendroplet/droplet/dropletfile/parser"
+)
+
+// parsePackageTest parses a single PACKAGE instruction
+func parsePackageTest(t *testing.T, line string) (*PackageCommand, error) {
+	t.Helper()
+
+	result, err := parser.Parse(strings.NewReader(line + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := ParseInstruction(result.AST.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	return cmd.(*PackageCommand), nil
+}
+
+func TestSplitPackage(t *testing.T) {
+	tests := []struct {
+		p, name, version string
+	}{
+		{"nginx", "nginx", ""},
+		{"nginx@1.18", "nginx", "1.18"},
+		{"nginx@1.18*", "nginx", "1.18*"},
+		{"flask@>=1.1", "flask", ">=1.1"},
+		{"git@1:2.30.2-1", "git", "1:2.30.2-1"},
+		{"@angular/cli", "@angular/cli", ""},
+		{"@angular/cli@12.0.0", "@angular/cli", "12.0.0"},
+	}
+	for _, test := range tests {
+		name, version, err := SplitPackage(test.p)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.p, err)
+			continue
+		}
+		if name != test.name || version != test.version {
+			t.Errorf("%s: expected %q %q, got %q %q", test.p, test.name, test.version, name, version)
+		}
+	}
+
+	if _, _, err := SplitPackage("nginx@"); err == nil {
+		t.Error("nginx@: expected an error")
+	}
+}
+
+func TestParsePackageMap(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected PackageMap
+	}{
+		{"PACKAGE php", nil},
+		{
+			"PACKAGE --map=apt:php-fpm,apk:php7 php@7.4",
+			PackageMap{"php": {"apt": "php-fpm", "apk": "php7"}},
+		},
+		{
+			"PACKAGE --map=php=apt:php-fpm --map=vim=dnf:vim-enhanced,brew:vim php vim",
+			PackageMap{"php": {"apt": "php-fpm"}, "vim": {"dnf": "vim-enhanced", "brew": "vim"}},
+		},
+		{
+			"PACKAGE --map=apt:python3=3.9* python",
+			PackageMap{"python": {"apt": "python3=3.9*"}},
+		},
+	}
+	for _, test := range tests {
+		cmd, err := parsePackageTest(t, test.line)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd.Map, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.line, test.expected, cmd.Map)
+		}
+	}
+}
+
+func TestParsePackageErrors(t *testing.T) {
+	tests := map[string]string{
+		"PACKAGE nginx@":                    `invalid PACKAGE "nginx@", expected a version after @`,
+		"PACKAGE --map=apt:php-fpm php vim": "PACKAGE --map=apt:php-fpm has several packages, use --map=<package>=apt:php-fpm",
+		"PACKAGE --map=apt php":             `invalid PACKAGE --map item "apt", expected <manager>:<package>`,
+		"PACKAGE --map=apt:,apk:php7 php":   `invalid PACKAGE --map item "apt:", expected <manager>:<package>`,
+	}
+	for line, expected := range tests {
+		_, err := parsePackageTest(t, line)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected the error %q, got %v", line, expected, err)
+		}
+	}
+}
+
+func TestPackage(t *testing.T) {
+	cmd := PackageCommand{Map: PackageMap{
+		"php":    {"apt": "php-fpm", "apk": "php7@7.3"},
+		"python": {"apt": "python3"},
+	}}
+	tests := []struct {
+		p, manager, name, version string
+	}{
+		{"php@7.4", "apt", "php-fpm", "7.4"},
+		{"php@7.4", "apk", "php7", "7.3"},
+		{"php@7.4", "dnf", "php", "7.4"},
+		{"python", "apt", "python3", ""},
+		{"curl@7.74", "apt", "curl", "7.74"},
+	}
+	for _, test := range tests {
+		name, version := cmd.Package(test.p, test.manager)
+		if name != test.name || version != test.version {
+			t.Errorf("%s for %s: expected %q %q, got %q %q", test.p, test.manager, test.name, test.version, name, version)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package instructions
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"sort"
 	"strings"
@@ -12,6 +13,12 @@ import (
 	"github.com/pkg/errors"
 )
 
+var reNumericID = regexp.MustCompile(`^[0-9]+$`)
+
+var reOctalMode = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+var reRepositoryName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(/[a-zA-Z0-9_.-]+)?$`)
+
 type parseRequest struct {
 	command    string
 	args       []string
@@ -84,11 +91,18 @@ func ParseInstruction(node *parser.Node) (v interface{}, err error) {
 		return parseUser(req)
 	case command.Package:
 		return parsePackage(req)
+	case command.Repository:
+		return parseRepository(req)
 	case command.Workdir:
 		return parseWorkdir(req)
 	}
 
-	return nil, &UnknownInstruction{Instruction: node.Value, Line: node.StartLine}
+	return nil, &UnknownInstruction{
+		Line:        node.StartLine,
+		Instruction: node.Value,
+		Suggestion:  parser.SuggestInstruction(node.Value),
+		Location:    node.Location(),
+	}
 }
 
 // ParseCommand converts an AST to a typed Command
@@ -107,14 +121,7 @@ func ParseCommand(node *parser.Node) (Command, error) {
 }
 
 // UnknownInstruction represents an error occurring when a command is unresolvable
-type UnknownInstruction struct {
-	Line        int
-	Instruction string
-}
-
-func (e *UnknownInstruction) Error() string {
-	return fmt.Sprintf("unknown instruction: %s", strings.ToUpper(e.Instruction))
-}
+type UnknownInstruction = parser.UnknownInstruction
 
 type parseError struct {
 	inner error
@@ -131,7 +138,13 @@ func (e *parseError) Unwrap() error {
 
 // Parse a Dropletfile into a collection of buildable stages.
 func Parse(ast *parser.Node) (stages []Stage, metaArgs []ArgCommand, err error) {
+	workdir, workdirKnown := "", true
 	for _, n := range ast.Children {
+		if _, ok := command.Commands[n.Value]; !ok {
+			// Reported by the parser, either as a warning or as an error
+			continue
+		}
+
 		cmd, err := ParseInstruction(n)
 
 		if err != nil {
@@ -149,11 +162,20 @@ func Parse(ast *parser.Node) (stages []Stage, metaArgs []ArgCommand, err error)
 		switch c := cmd.(type) {
 		case *Stage:
 			stages = append(stages, *c)
+			workdir, workdirKnown = "", true
 		case Command:
 			stage, err := CurrentStage(stages)
 			if err != nil {
 				return nil, nil, parser.WithLocation(err, n.Location())
 			}
+			if w, ok := c.(*WorkdirCommand); ok {
+				// Paths using variables are resolved once expanded by the build
+				workdirKnown = !strings.Contains(w.Path, "$") && (workdirKnown || path.IsAbs(w.Path))
+				if workdirKnown {
+					w.Resolved = ResolvePath(workdir, w.Path)
+					workdir = w.Resolved
+				}
+			}
 			stage.AddCommand(c)
 		default:
 			return nil, nil, parser.WithLocation(errors.Errorf("%T is not a command type", cmd), n.Location())
@@ -225,15 +247,25 @@ func parseArg(req parseRequest) (*ArgCommand, error) {
 }
 
 func parseConfig(req parseRequest) (*ConfigCommand, error) {
-	if len(req.args) == 0 {
-		return nil, errAtLeastOneArgument("CONFIG")
+	if len(req.args) != 2 {
+		return nil, errExactlyTwoArguments("CONFIG")
 	}
 
-	configsTab := req.args
-	sort.Strings(configsTab)
+	flMode := req.flags.AddString("mode", "")
+	flOwner := req.flags.AddString("owner", "")
+
+	if err := req.flags.Parse(); err != nil {
+		return nil, err
+	}
+
+	if flMode.Value != "" && !strings.HasPrefix(flMode.Value, "$") && !reOctalMode.MatchString(flMode.Value) {
+		return nil, errors.Errorf("invalid CONFIG mode %q, expected an octal mode like 0644", flMode.Value)
+	}
 
 	return &ConfigCommand{
-		Configs:         configsTab,
+		SourcesAndDest:  SourcesAndDest(req.args),
+		Mode:            flMode.Value,
+		Owner:           flOwner.Value,
 		withNameAndCode: newWithNameAndCode(req),
 	}, nil
 }
@@ -259,33 +291,88 @@ func parseCopy(req parseRequest) (*CopyCommand, error) {
 }
 
 func parseCron(req parseRequest) (*CronCommand, error) {
-	if len(req.args) < 5 {
-		return nil, errAtLeastSixArgument("CRON")
+	flUser := req.flags.AddString("user", "")
+	flName := req.flags.AddString("name", "")
+	flAction := req.flags.AddString("action", "")
+
+	if err := req.flags.Parse(); err != nil {
+		return nil, err
+	}
+
+	switch flAction.Value {
+	case "", CronInstall, CronRemove:
+	default:
+		return nil, errors.Errorf("invalid CRON action %q, expected %s or %s", flAction.Value, CronInstall, CronRemove)
+	}
+	if flName.Value != "" && !reCronName.MatchString(flName.Value) {
+		return nil, errors.Errorf("invalid CRON name %q, only letters, digits, '_', '.' and '-' are allowed", flName.Value)
+	}
+
+	cmd := &CronCommand{
+		withNameAndCode: newWithNameAndCode(req),
+		User:            flUser.Value,
+		EntryName:       flName.Value,
+		Action:          flAction.Value,
 	}
 
-	schedule := make([]string, 5)
-	copy(schedule, req.args)
+	if len(req.args) > 0 && strings.HasPrefix(req.args[0], "@") {
+		if len(req.args) < 2 {
+			return nil, errors.New("CRON requires a command after the schedule")
+		}
+		if _, ok := CronMacros[strings.ToLower(req.args[0])]; !ok {
+			return nil, errors.Errorf("invalid CRON schedule %q", req.args[0])
+		}
+		cmd.Macro = strings.ToLower(req.args[0])
+		req.args = append(req.args[:0], req.args[1:]...)
+	} else {
+		if len(req.args) < 6 {
+			return nil, errAtLeastSixArgument("CRON")
+		}
 
-	req.args = append(req.args[:0], req.args[5:]...)
+		schedule := make([]string, 5)
+		copy(schedule, req.args)
+		if err := validateCronSchedule(schedule); err != nil {
+			return nil, err
+		}
 
-	return &CronCommand{
-		withNameAndCode:       newWithNameAndCode(req),
-		Minute:                schedule[0],
-		Hour:                  schedule[1],
-		DayOfTheMonth:         schedule[2],
-		Month:                 schedule[3],
-		DayOfTheWeek:          schedule[4],
-		ShellDependantCmdLine: parseShellDependentCommand(req, false),
-	}, nil
+		cmd.Minute = schedule[0]
+		cmd.Hour = schedule[1]
+		cmd.DayOfTheMonth = schedule[2]
+		cmd.Month = schedule[3]
+		cmd.DayOfTheWeek = schedule[4]
+		req.args = append(req.args[:0], req.args[5:]...)
+	}
+
+	cmd.ShellDependantCmdLine = parseShellDependentCommand(req, false)
+	return cmd, nil
 }
 
 func parseDelete(req parseRequest) (*DeleteCommand, error) {
+	flForce := req.flags.AddBool("force", false)
+	flDryRun := req.flags.AddBool("dry-run", false)
+
+	if err := req.flags.Parse(); err != nil {
+		return nil, err
+	}
+
 	if len(req.args) == 0 {
 		return nil, errNoDestinationArgument("DELETE")
 	}
 
+	// Paths using variables are checked once expanded
+	for _, p := range req.args {
+		if strings.Contains(p, "$") {
+			continue
+		}
+		if err := ValidateDeletePath(p, flForce.IsTrue()); err != nil {
+			return nil, err
+		}
+	}
+
 	return &DeleteCommand{
 		SourcesAndDest:  SourcesAndDest(req.args),
+		Force:           flForce.IsTrue(),
+		DryRun:          flDryRun.IsTrue(),
 		withNameAndCode: newWithNameAndCode(req),
 	}, nil
 }
@@ -312,13 +399,37 @@ func parseExpose(req parseRequest) (*ExposeCommand, error) {
 		return nil, errAtLeastOneArgument("EXPOSE")
 	}
 
+	flFrom := req.flags.AddString("from", "")
+
+	if err := req.flags.Parse(); err != nil {
+		return nil, err
+	}
+
 	portsTab := req.args
 	sort.Strings(portsTab)
 
-	return &ExposeCommand{
+	cmd := &ExposeCommand{
 		Ports:           portsTab,
+		From:            flFrom.Value,
 		withNameAndCode: newWithNameAndCode(req),
-	}, nil
+	}
+
+	// Specs using variables are checked once expanded
+	if !strings.Contains(flFrom.Value, "$") && flFrom.Value != "" {
+		if err := validateSource(flFrom.Value); err != nil {
+			return nil, err
+		}
+	}
+	for _, port := range portsTab {
+		if strings.Contains(port, "$") {
+			continue
+		}
+		if _, err := ParsePortSpec(port); err != nil {
+			return nil, err
+		}
+	}
+
+	return cmd, nil
 }
 
 func parseLabel(req parseRequest) (*LabelCommand, error) {
@@ -340,14 +451,108 @@ func parseLabel(req parseRequest) (*LabelCommand, error) {
 
 func parsePackage(req parseRequest) (*PackageCommand, error) {
 	flAction := req.flags.AddString("action", "")
+	flMap := req.flags.AddStrings("map")
+	flManager := req.flags.AddString("manager", "")
+	flTarget := req.flags.AddString("target", "")
 
 	if err := req.flags.Parse(); err != nil {
 		return nil, err
 	}
 
+	// The action defaults to the stage, it is checked once known
+	if flAction.Value != "" && !strings.Contains(flAction.Value, "$") {
+		if err := ValidatePackageAction(flAction.Value, req.args); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range req.args {
+		if _, _, err := SplitPackage(p); err != nil {
+			return nil, err
+		}
+	}
+
+	packageMap, err := parsePackageMap(flMap.StringValues, req.args)
+	if err != nil {
+		return nil, err
+	}
+
 	return &PackageCommand{
 		Packages:        []string(req.args),
 		Action:          flAction.Value,
+		Map:             packageMap,
+		Manager:         flManager.Value,
+		Target:          flTarget.Value,
+		withNameAndCode: newWithNameAndCode(req),
+	}, nil
+}
+
+// parsePackageMap parses the --map flags of a PACKAGE instruction, like
+// apt:php-fpm,apk:php7 for its single package, or php=apt:php-fpm,apk:php7
+func parsePackageMap(values []string, packages []string) (PackageMap, error) {
+	res := PackageMap{}
+	for _, value := range values {
+		name := ""
+		if i := strings.Index(value, "="); i >= 0 && i < strings.Index(value, ":") {
+			name, value = value[:i], value[i+1:]
+		} else if len(packages) == 1 {
+			name, _, _ = SplitPackage(packages[0])
+		} else {
+			return nil, errors.Errorf("PACKAGE --map=%s has several packages, use --map=<package>=%s", value, value)
+		}
+
+		if res[name] == nil {
+			res[name] = map[string]string{}
+		}
+		for _, item := range strings.Split(value, ",") {
+			fields := strings.SplitN(item, ":", 2)
+			if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+				return nil, errors.Errorf("invalid PACKAGE --map item %q, expected <manager>:<package>", item)
+			}
+			res[name][fields[0]] = fields[1]
+		}
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	return res, nil
+}
+
+func parseRepository(req parseRequest) (*RepositoryCommand, error) {
+	if len(req.args) != 1 {
+		return nil, errExactlyOneArgument("REPOSITORY")
+	}
+
+	flName := req.flags.AddString("name", "")
+	flKey := req.flags.AddString("key", "")
+	flSuite := req.flags.AddString("suite", "")
+	flComponents := req.flags.AddString("components", "")
+	flAction := req.flags.AddString("action", "")
+
+	if err := req.flags.Parse(); err != nil {
+		return nil, err
+	}
+
+	switch flAction.Value {
+	case "", RepositoryAdd, RepositoryRemove:
+	default:
+		return nil, errors.Errorf("invalid REPOSITORY action %q, expected %s or %s", flAction.Value, RepositoryAdd, RepositoryRemove)
+	}
+	if flName.Value != "" && !strings.Contains(flName.Value, "$") && !reRepositoryName.MatchString(flName.Value) {
+		return nil, errors.Errorf("invalid REPOSITORY name %q, only letters, digits, '_', '.', '-' and a '/' for a brew tap are allowed", flName.Value)
+	}
+
+	var components []string
+	if flComponents.Value != "" {
+		components = strings.Split(flComponents.Value, ",")
+	}
+
+	return &RepositoryCommand{
+		URL:             req.args[0],
+		RepositoryName:  flName.Value,
+		Key:             flKey.Value,
+		Suite:           flSuite.Value,
+		Components:      components,
+		Action:          flAction.Value,
 		withNameAndCode: newWithNameAndCode(req),
 	}, nil
 }
@@ -378,17 +583,45 @@ func parseRun(req parseRequest) (*RunCommand, error) {
 }
 
 func parseStage(req parseRequest) (*Stage, error) {
-	if len(req.args) != 1 {
+	// Flags are allowed after the stage name: STAGE name --depends=other
+	args := []string{}
+	for _, arg := range req.args {
+		if strings.HasPrefix(arg, "--") {
+			req.flags.Args = append(req.flags.Args, arg)
+		} else {
+			args = append(args, arg)
+		}
+	}
+
+	if len(args) != 1 {
 		return nil, errExactlyOneArgument("STAGE")
 	}
 
-	stageName := strings.ToLower(req.args[0])
-	if ok, _ := regexp.MatchString("^[a-z][a-z0-9-_\\.]*$", stageName); !ok {
-		return nil, errors.Errorf("invalid name for build stage: %q, name can't start with a number or contain symbols", req.args[0])
+	flDepends := req.flags.AddStrings("depends")
+
+	if err := req.flags.Parse(); err != nil {
+		return nil, err
+	}
+
+	stageName := strings.ToLower(args[0])
+	if !isValidStageName(stageName) {
+		return nil, errors.Errorf("invalid name for build stage: %q, name can't start with a number or contain symbols", args[0])
+	}
+
+	depends := []string{}
+	for _, value := range flDepends.StringValues {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !isValidStageName(name) {
+				return nil, errors.Errorf("invalid stage name in --depends: %q", name)
+			}
+			depends = append(depends, name)
+		}
 	}
 
 	return &Stage{
 		Name:       stageName,
+		Depends:    depends,
 		SourceCode: strings.TrimSpace(req.original),
 		Commands:   []Command{},
 		Location:   req.location,
@@ -396,15 +629,53 @@ func parseStage(req parseRequest) (*Stage, error) {
 	}, nil
 }
 
+func isValidStageName(name string) bool {
+	ok, _ := regexp.MatchString("^[a-z][a-z0-9-_\\.]*$", name)
+	return ok
+}
+
 func parseUser(req parseRequest) (*UserCommand, error) {
+	flCreate := req.flags.AddBool("create", false)
+	flUID := req.flags.AddString("uid", "")
+	flHome := req.flags.AddString("home", "")
+	flShell := req.flags.AddString("shell", "")
+
+	if err := req.flags.Parse(); err != nil {
+		return nil, err
+	}
+
 	if len(req.args) != 1 {
 		return nil, errExactlyOneArgument("USER")
 	}
 
-	return &UserCommand{
+	cmd := &UserCommand{
 		User:            req.args[0],
+		Create:          flCreate.IsTrue(),
+		UID:             flUID.Value,
+		Home:            flHome.Value,
+		Shell:           flShell.Value,
 		withNameAndCode: newWithNameAndCode(req),
-	}, nil
+	}
+
+	user, _ := cmd.UserAndGroup()
+	if user == "" {
+		return nil, errors.New("USER requires a user name")
+	}
+	if cmd.Create && reNumericID.MatchString(user) {
+		return nil, errors.Errorf("USER --create requires a user name, not the id %s, use --uid", user)
+	}
+	if !cmd.Create {
+		for _, fl := range []*Flag{flUID, flHome, flShell} {
+			if fl.Value != "" {
+				return nil, errors.Errorf("USER --%s requires --create", fl.name)
+			}
+		}
+	}
+	if cmd.UID != "" && !strings.Contains(cmd.UID, "$") && !reNumericID.MatchString(cmd.UID) {
+		return nil, errors.Errorf("invalid USER uid %q, expected a number", cmd.UID)
+	}
+
+	return cmd, nil
 }
 
 func parseWorkdir(req parseRequest) (*WorkdirCommand, error) {
@@ -444,6 +715,10 @@ func errExactlyOneArgument(command string) error {
 	return errors.Errorf("%s requires exactly one argument", command)
 }
 
+func errExactlyTwoArguments(command string) error {
+	return errors.Errorf("%s requires exactly two arguments", command)
+}
+
 func errNoDestinationArgument(command string) error {
 	return errors.Errorf("%s requires at least two arguments, but only one was provided. Destination could not be determined.", command)
 }
@@ -0,0 +1,33 @@
+package instructions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getopendroplet/droplet/dropletfile/parser"
+)
+
+func TestParseSkipsUnknownInstructions(t *testing.T) {
+	result, err := parser.Parse(strings.NewReader("STAGE install\nRUNN echo a\nRUN echo b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages, _, err := Parse(result.AST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) != 1 || len(stages[0].Commands) != 1 {
+		t.Fatalf("expected the unknown instruction to be skipped, got %+v", stages)
+	}
+}
+
+func TestParseInstructionSuggestion(t *testing.T) {
+	result, err := parser.Parse(strings.NewReader("STAGE install\nCOPPY a b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseInstruction(result.AST.Children[1])
+	if err == nil || err.Error() != "unknown instruction: COPPY (did you mean COPY?)" {
+		t.Errorf("expected the unknown instruction error with a suggestion, got %v", err)
+	}
+}
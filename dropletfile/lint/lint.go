@@ -0,0 +1,236 @@
+// Package lint implements rule based diagnostics of Dropletfiles.
+package lint
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getopendroplet/droplet/dropletfile/command"
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+	"github.com/getopendroplet/droplet/dropletfile/parser"
+)
+
+// SyntaxRule is the rule of the diagnostics reporting instructions which
+// can't be parsed
+const SyntaxRule = "syntax"
+
+var reIgnore = regexp.MustCompile(`^droplet:ignore\s+(.+)$`)
+
+// Severity of a diagnostic
+type Severity int
+
+// Severities
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// MarshalText marshals the severity to its name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// MarshalYAML marshals the severity to its name
+func (s Severity) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// Diagnostic is a problem found by a rule
+type Diagnostic struct {
+	Rule     string         `json:"rule"`
+	Severity Severity       `json:"severity"`
+	Message  string         `json:"message"`
+	File     string         `json:"file"`
+	Location []parser.Range `json:"location"`
+}
+
+// Line returns the first line of the diagnostic, or 0 if it has no location
+func (d Diagnostic) Line() int {
+	if len(d.Location) == 0 {
+		return 0
+	}
+	return d.Location[0].Start.Line
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s [%s]", d.File, d.Line(), d.Severity, d.Message, d.Rule)
+}
+
+// Context is the Dropletfile checked by the rules
+type Context struct {
+	Dropletfile string
+	ContextDir  string // dir of the files copied by the Dropletfile, empty if unknown
+	AST         *parser.Node
+	Unknown     []*parser.UnknownInstruction
+	Stages      []instructions.Stage
+	MetaArgs    []instructions.ArgCommand
+}
+
+// Rule is a check of a Dropletfile
+type Rule struct {
+	Name        string                                `json:"name" yaml:"name"`
+	Description string                                `json:"description" yaml:"description"`
+	Severity    Severity                              `json:"severity" yaml:"severity"`
+	Check       func(ctx *Context, report ReportFunc) `json:"-" yaml:"-"`
+}
+
+// ReportFunc reports a problem found at location by a rule
+type ReportFunc func(location []parser.Range, format string, args ...interface{})
+
+var rules = map[string]*Rule{}
+
+// AddRule - add a rule
+func AddRule(rule *Rule) {
+	rules[rule.Name] = rule
+}
+
+// DeleteRule - delete a rule
+func DeleteRule(name string) {
+	delete(rules, name)
+}
+
+// ExistsRule - check if a rule exists
+func ExistsRule(name string) bool {
+	_, ok := rules[name]
+	return ok
+}
+
+// GetRule - get a rule
+func GetRule(name string) *Rule {
+	return rules[name]
+}
+
+// Rules - list the rules sorted by name
+func Rules() []*Rule {
+	res := []*Rule{}
+	for _, rule := range rules {
+		res = append(res, rule)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// Lint parses a Dropletfile and checks it with all the rules. Instructions
+// which can't be parsed are reported with the syntax rule. Diagnostics of the
+// rules named by a "# droplet:ignore <rule>..." comment preceding an
+// instruction are suppressed.
+func Lint(r io.Reader, dropletfile string, contextDir string) ([]Diagnostic, error) {
+	result, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &Context{
+		Dropletfile: dropletfile,
+		ContextDir:  contextDir,
+		AST:         result.AST,
+		Unknown:     result.Unknown,
+	}
+	diagnostics := []Diagnostic{}
+	ignored := map[int]map[string]bool{}
+
+	for _, node := range result.AST.Children {
+		ignored[node.StartLine] = ignoredRules(node.PrevComment)
+
+		if _, ok := command.Commands[node.Value]; !ok {
+			// Reported by the unknown-instruction rule
+			continue
+		}
+
+		if err := ctx.add(node); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Rule:     SyntaxRule,
+				Severity: SeverityError,
+				Message:  err.Error(),
+				File:     dropletfile,
+				Location: node.Location(),
+			})
+		}
+	}
+
+	for _, rule := range Rules() {
+		rule.Check(ctx, func(location []parser.Range, format string, args ...interface{}) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Message:  fmt.Sprintf(format, args...),
+				File:     dropletfile,
+				Location: location,
+			})
+		})
+	}
+
+	res := []Diagnostic{}
+	for _, d := range diagnostics {
+		if ignored[d.Line()][d.Rule] {
+			continue
+		}
+		res = append(res, d)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Line() < res[j].Line()
+	})
+
+	return res, nil
+}
+
+// add adds the instruction of a node to the stages, like instructions.Parse
+func (ctx *Context) add(node *parser.Node) error {
+	cmd, err := instructions.ParseInstruction(node)
+	if err != nil {
+		return err
+	}
+
+	if len(ctx.Stages) == 0 {
+		if a, isArg := cmd.(*instructions.ArgCommand); isArg {
+			ctx.MetaArgs = append(ctx.MetaArgs, *a)
+			return nil
+		}
+	}
+
+	switch c := cmd.(type) {
+	case *instructions.Stage:
+		ctx.Stages = append(ctx.Stages, *c)
+	case instructions.Command:
+		stage, err := instructions.CurrentStage(ctx.Stages)
+		if err != nil {
+			return err
+		}
+		stage.AddCommand(c)
+	}
+
+	return nil
+}
+
+func ignoredRules(comments []string) map[string]bool {
+	res := map[string]bool{}
+	for _, comment := range comments {
+		match := reIgnore.FindStringSubmatch(comment)
+		if match == nil {
+			continue
+		}
+		for _, name := range strings.FieldsFunc(match[1], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}) {
+			res[name] = true
+		}
+	}
+	return res
+}
@@ -0,0 +1,149 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testContext is the build context of the COPY and CONFIG rules
+const testContext = "testdata/context"
+
+// lintTest lints a Dropletfile, the diagnostics are formatted as
+// "<line> <rule>"
+func lintTest(t *testing.T, dropletfile string) []string {
+	t.Helper()
+
+	diagnostics, err := Lint(strings.NewReader(dropletfile), "Dropletfile", testContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := []string{}
+	for _, d := range diagnostics {
+		res = append(res, fmt.Sprintf("%d %s", d.Line(), d.Rule))
+	}
+	return res
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule        string
+		dropletfile string
+		expected    []string
+	}{
+		{
+			"duplicate-env",
+			"STAGE install\nENV A=1 B=2\nENV A=3\nSTAGE update\nENV A=4\n",
+			[]string{"3 duplicate-env"},
+		},
+		{
+			"duplicate-env",
+			"STAGE install\nENV A=1 A=2\n",
+			[]string{"2 duplicate-env"},
+		},
+		{
+			"empty-package",
+			"STAGE install\nPACKAGE\nPACKAGE --action=update\nPACKAGE --action=upgrade\nPACKAGE --action=clean\nPACKAGE --action=remove\nPACKAGE curl\n",
+			[]string{"2 empty-package", "6 syntax"},
+		},
+		{
+			"empty-package",
+			"STAGE update\nPACKAGE\nSTAGE remove\nPACKAGE\n",
+			[]string{"4 empty-package"},
+		},
+		{
+			"missing-config-template",
+			"STAGE install\nCONFIG app.conf.tmpl /etc/app.conf\nCONFIG missing.tmpl /etc/missing.conf\nCONFIG $TEMPLATE /etc/app.conf\n",
+			[]string{"3 missing-config-template"},
+		},
+		{
+			"missing-copy-source",
+			"STAGE install\nCOPY src /srv/\nCOPY src/*.go /srv/\nCOPY *.txt /srv/\nCOPY missing.txt /srv/\nCOPY $SRC /srv/\n",
+			[]string{"4 missing-copy-source", "5 missing-copy-source"},
+		},
+		{
+			"relative-workdir",
+			"STAGE install\nWORKDIR app\nWORKDIR /srv\nWORKDIR app\nSTAGE update\nWORKDIR $HOME\nWORKDIR app\n",
+			[]string{"2 relative-workdir"},
+		},
+		{
+			"syntax",
+			"STAGE install\nCOPY onlyone\nRUN true\n",
+			[]string{"2 syntax"},
+		},
+		{
+			"syntax",
+			"RUN true\n",
+			[]string{"1 syntax"},
+		},
+	}
+
+	for _, test := range tests {
+		res := lintTest(t, test.dropletfile)
+		if strings.Join(res, ", ") != strings.Join(test.expected, ", ") {
+			t.Errorf("%s: expected %q, got %q\n%s", test.rule, test.expected, res, test.dropletfile)
+		}
+	}
+}
+
+func TestRulesWithoutContext(t *testing.T) {
+	diagnostics, err := Lint(strings.NewReader("STAGE install\nCOPY missing.txt /srv/\nCONFIG missing.tmpl /etc/app.conf\n"), "Dropletfile", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) > 0 {
+		t.Errorf("expected no diagnostic without a build context, got %v", diagnostics)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	dropletfile := `STAGE install
+ENV A=1
+# droplet:ignore duplicate-env
+ENV A=2
+# droplet:ignore relative-workdir, missing-copy-source
+WORKDIR app
+# droplet:ignore relative-workdir
+COPY missing.txt /srv/
+`
+	res := lintTest(t, dropletfile)
+	expected := []string{"8 missing-copy-source"}
+	if strings.Join(res, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected %q, got %q", expected, res)
+	}
+}
+
+func TestRulesRegistered(t *testing.T) {
+	names := []string{}
+	for _, rule := range Rules() {
+		if rule.Check == nil || rule.Description == "" {
+			t.Errorf("rule %s has no check or description", rule.Name)
+		}
+		names = append(names, rule.Name)
+	}
+
+	expected := "duplicate-env empty-package missing-config-template missing-copy-source relative-workdir unknown-instruction"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("expected the rules %s, got %s", expected, strings.Join(names, " "))
+	}
+}
+
+func TestUnknownInstruction(t *testing.T) {
+	dropletfile := "STAGE install\nRUNN echo a\nXYZ b\n# droplet:ignore unknown-instruction\nXYZ c\nRUN echo d\n"
+	diagnostics, err := Lint(strings.NewReader(dropletfile), "Dropletfile", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := []string{}
+	for _, d := range diagnostics {
+		res = append(res, d.String())
+	}
+	expected := []string{
+		"Dropletfile:2: error: unknown instruction RUNN is ignored, did you mean RUN? [unknown-instruction]",
+		"Dropletfile:3: error: unknown instruction XYZ is ignored [unknown-instruction]",
+	}
+	if strings.Join(res, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(res, "\n"))
+	}
+}
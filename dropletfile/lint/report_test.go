@@ -0,0 +1,86 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// reportDropletfile has a warning on line 3 and an error on lines 4 to 5
+const reportDropletfile = "STAGE install\nENV A=1\nENV A=2\nCOPY missing.txt \\\n    /srv/\n"
+
+func reportTest(t *testing.T, format string) []byte {
+	t.Helper()
+
+	diagnostics, err := Lint(strings.NewReader(reportDropletfile), "Dropletfile", testContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, format, diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteText(t *testing.T) {
+	expected := "Dropletfile:3: warning: ENV A is already set in stage install [duplicate-env]\n" +
+		"Dropletfile:4: error: COPY source missing.txt not found in testdata/context [missing-copy-source]\n"
+	if res := string(reportTest(t, FormatText)); res != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, res)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var res []struct {
+		Rule     string
+		Severity string
+		Message  string
+		File     string
+	}
+	if err := json.Unmarshal(reportTest(t, FormatJSON), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].Rule != "duplicate-env" || res[0].Severity != "warning" || res[1].Severity != "error" || res[1].File != "Dropletfile" {
+		t.Errorf("unexpected diagnostics %+v", res)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var res sarifLog
+	if err := json.Unmarshal(reportTest(t, FormatSARIF), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Version != "2.1.0" || res.Schema != sarifSchema || len(res.Runs) != 1 {
+		t.Fatalf("unexpected SARIF log %+v", res)
+	}
+
+	// Every reported rule is described by the driver
+	run := res.Runs[0]
+	rules := map[string]string{}
+	for _, rule := range run.Tool.Driver.Rules {
+		rules[rule.ID] = rule.DefaultConfiguration.Level
+	}
+	if len(rules) != len(Rules())+1 || rules[SyntaxRule] != "error" || rules["relative-workdir"] != "warning" {
+		t.Errorf("unexpected rules %v", rules)
+	}
+
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", run.Results)
+	}
+	result := run.Results[1]
+	if result.RuleID != "missing-copy-source" || result.Level != "error" || rules[result.RuleID] == "" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	location := result.Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "Dropletfile" || location.Region == nil || location.Region.StartLine != 4 || location.Region.EndLine != 5 {
+		t.Errorf("unexpected location %+v", location)
+	}
+}
+
+func TestWriteInvalidFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "xml", nil); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,175 @@
+package lint
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/getopendroplet/droplet/dropletfile/buildcontext"
+	"github.com/getopendroplet/droplet/dropletfile/instructions"
+)
+
+func init() {
+	AddRule(&Rule{
+		Name:        "duplicate-env",
+		Description: "ENV key set more than once in a stage",
+		Severity:    SeverityWarning,
+		Check:       checkDuplicateEnv,
+	})
+	AddRule(&Rule{
+		Name:        "empty-package",
+		Description: "PACKAGE installing or removing no package",
+		Severity:    SeverityError,
+		Check:       checkEmptyPackage,
+	})
+	AddRule(&Rule{
+		Name:        "missing-config-template",
+		Description: "CONFIG template not found in the build context",
+		Severity:    SeverityError,
+		Check:       checkMissingConfigTemplate,
+	})
+	AddRule(&Rule{
+		Name:        "missing-copy-source",
+		Description: "COPY source not found in the build context",
+		Severity:    SeverityError,
+		Check:       checkMissingCopySource,
+	})
+	AddRule(&Rule{
+		Name:        "relative-workdir",
+		Description: "relative WORKDIR without a prior absolute WORKDIR in the stage",
+		Severity:    SeverityWarning,
+		Check:       checkRelativeWorkdir,
+	})
+	AddRule(&Rule{
+		Name:        "unknown-instruction",
+		Description: "unknown instruction, ignored by the parser",
+		Severity:    SeverityError,
+		Check:       checkUnknownInstruction,
+	})
+}
+
+func checkDuplicateEnv(ctx *Context, report ReportFunc) {
+	for _, stage := range ctx.Stages {
+		seen := map[string]bool{}
+		for _, c := range stage.Commands {
+			env, ok := c.(*instructions.EnvCommand)
+			if !ok {
+				continue
+			}
+			for _, kvp := range env.Env {
+				if seen[kvp.Key] {
+					report(env.Location(), "ENV %s is already set in stage %s", kvp.Key, stage.Name)
+				}
+				seen[kvp.Key] = true
+			}
+		}
+	}
+}
+
+func checkEmptyPackage(ctx *Context, report ReportFunc) {
+	for _, stage := range ctx.Stages {
+		for _, c := range stage.Commands {
+			pkg, ok := c.(*instructions.PackageCommand)
+			if !ok || len(pkg.Packages) > 0 {
+				continue
+			}
+
+			// Updating, upgrading and cleaning don't need packages, the stages
+			// named after an action set it like in the build
+			action := pkg.Action
+			if action == "" {
+				action = instructions.PackageInstall
+				switch stage.Name {
+				case instructions.PackageUpdate, instructions.PackageRemove:
+					action = stage.Name
+				}
+			}
+			if !instructions.PackageActions[action] {
+				continue
+			}
+			report(pkg.Location(), "PACKAGE has no package to %s", action)
+		}
+	}
+}
+
+func checkMissingCopySource(ctx *Context, report ReportFunc) {
+	if ctx.ContextDir == "" {
+		return
+	}
+	buildContext, err := buildcontext.Load(ctx.ContextDir)
+	if err != nil {
+		return
+	}
+
+	for _, stage := range ctx.Stages {
+		for _, c := range stage.Commands {
+			cp, ok := c.(*instructions.CopyCommand)
+			if !ok {
+				continue
+			}
+
+			for _, src := range cp.Sources() {
+				if strings.Contains(src, "$") {
+					// Depends on the build args
+					continue
+				}
+				src = strings.Trim(src, `"'`)
+
+				matches, err := buildContext.Glob(src)
+				if err != nil || len(matches) == 0 {
+					report(cp.Location(), "COPY source %s not found in %s", src, ctx.ContextDir)
+				}
+			}
+		}
+	}
+}
+
+func checkMissingConfigTemplate(ctx *Context, report ReportFunc) {
+	if ctx.ContextDir == "" {
+		return
+	}
+
+	for _, stage := range ctx.Stages {
+		for _, c := range stage.Commands {
+			config, ok := c.(*instructions.ConfigCommand)
+			if !ok || strings.Contains(config.Template(), "$") {
+				continue
+			}
+
+			if _, err := os.Stat(filepath.Join(ctx.ContextDir, filepath.FromSlash(config.Template()))); err != nil {
+				report(config.Location(), "CONFIG template %s not found in %s", config.Template(), ctx.ContextDir)
+			}
+		}
+	}
+}
+
+func checkRelativeWorkdir(ctx *Context, report ReportFunc) {
+	for _, stage := range ctx.Stages {
+		absolute := false
+		for _, c := range stage.Commands {
+			workdir, ok := c.(*instructions.WorkdirCommand)
+			if !ok {
+				continue
+			}
+
+			if path.IsAbs(workdir.Path) || strings.HasPrefix(workdir.Path, "$") {
+				absolute = true
+				continue
+			}
+			if !absolute {
+				report(workdir.Location(), "WORKDIR %s is relative to the dir the stage %s runs in", workdir.Path, stage.Name)
+			}
+		}
+	}
+}
+
+func checkUnknownInstruction(ctx *Context, report ReportFunc) {
+	for _, u := range ctx.Unknown {
+		if u.Suggestion != "" {
+			report(u.Location, "unknown instruction %s is ignored, did you mean %s?", strings.ToUpper(u.Instruction), strings.ToUpper(u.Suggestion))
+		} else {
+			report(u.Location, "unknown instruction %s is ignored", strings.ToUpper(u.Instruction))
+		}
+	}
+}
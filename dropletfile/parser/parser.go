@@ -181,19 +181,20 @@ func init() {
 	// functions. Errors are propagated up by Parse() and the resulting AST can
 	// be incorporated directly into the existing AST as a next.
 	dispatch = map[string]func(string, *directives) (*Node, map[string]bool, error){
-		command.Arg:     parseNameOrNameVal,
-		command.Config:  parseStringsWhitespaceDelimited,
-		command.Copy:    parseMaybeJSONToList,
-		command.Cron:    parseMaybeJSONToList,
-		command.Delete:  parseMaybeJSONToList,
-		command.Env:     parseEnv,
-		command.Expose:  parseStringsWhitespaceDelimited,
-		command.Label:   parseLabel,
-		command.Package: parseMaybeJSONToList,
-		command.Run:     parseMaybeJSON,
-		command.Stage:   parseStringsWhitespaceDelimited,
-		command.User:    parseString,
-		command.Workdir: parseString,
+		command.Arg:        parseNameOrNameVal,
+		command.Config:     parseStringsWhitespaceDelimited,
+		command.Copy:       parseMaybeJSONToList,
+		command.Cron:       parseMaybeJSONToList,
+		command.Delete:     parseMaybeJSONToList,
+		command.Env:        parseEnv,
+		command.Expose:     parseStringsWhitespaceDelimited,
+		command.Label:      parseLabel,
+		command.Package:    parseMaybeJSONToList,
+		command.Repository: parseStringsWhitespaceDelimited,
+		command.Run:        parseMaybeJSON,
+		command.Stage:      parseStringsWhitespaceDelimited,
+		command.User:       parseString,
+		command.Workdir:    parseString,
 	}
 }
 
@@ -231,6 +232,12 @@ type Result struct {
 	AST         *Node
 	EscapeToken rune
 	Warnings    []string
+	Unknown     []*UnknownInstruction
+}
+
+// Options of the parser
+type Options struct {
+	Strict bool // unknown instructions are errors instead of warnings
 }
 
 // PrintWarnings to the writer
@@ -242,13 +249,20 @@ func (r *Result) PrintWarnings(out io.Writer) {
 }
 
 // Parse reads lines from a Reader, parses the lines into an AST and returns
-// the AST and escape token
+// the AST and escape token. Unknown instructions are reported as warnings.
 func Parse(rwc io.Reader) (*Result, error) {
+	return ParseWithOptions(rwc, Options{})
+}
+
+// ParseWithOptions is Parse, unknown instructions are errors in strict mode
+func ParseWithOptions(rwc io.Reader, opts Options) (*Result, error) {
 	d := newDefaultDirectives()
 	currentLine := 0
 	root := &Node{StartLine: -1}
 	scanner := bufio.NewScanner(rwc)
 	warnings := []string{}
+	unknown := []*UnknownInstruction{}
+	emptyContinuationLines := false
 	var comments []string
 
 	var err error
@@ -266,6 +280,7 @@ func Parse(rwc io.Reader) (*Result, error) {
 				comments = append(comments, comment)
 			}
 		}
+		column := len(bytesRead) - len(trimWhitespace(bytesRead))
 		bytesRead, err = processLine(d, bytesRead, true)
 		if err != nil {
 			return nil, withLocation(err, currentLine, 0)
@@ -301,6 +316,7 @@ func Parse(rwc io.Reader) (*Result, error) {
 		}
 
 		if hasEmptyContinuationLine {
+			emptyContinuationLines = true
 			warnings = append(warnings, "[WARNING]: Empty continuation line found in:\n    "+line)
 		}
 
@@ -310,9 +326,27 @@ func Parse(rwc io.Reader) (*Result, error) {
 		}
 		comments = nil
 		root.AddChild(child, startLine, currentLine)
+
+		if _, ok := dispatch[child.Value]; !ok {
+			keyword := reWhitespace.Split(strings.TrimSpace(line), 2)[0]
+			u := &UnknownInstruction{
+				Line:        startLine,
+				Instruction: child.Value,
+				Suggestion:  SuggestInstruction(child.Value),
+				Location: []Range{{
+					Start: Position{Line: startLine, Character: column},
+					End:   Position{Line: startLine, Character: column + len(keyword)},
+				}},
+			}
+			if opts.Strict {
+				return nil, WithLocation(errors.Wrapf(u, "dropletfile parse error line %d", startLine), u.Location)
+			}
+			unknown = append(unknown, u)
+			warnings = append(warnings, fmt.Sprintf("[WARNING]: Ignoring line %d: %s", startLine, u.Error()))
+		}
 	}
 
-	if len(warnings) > 0 {
+	if emptyContinuationLines {
 		warnings = append(warnings, "[WARNING]: Empty continuation lines will become errors in a future release.")
 	}
 
@@ -323,6 +357,7 @@ func Parse(rwc io.Reader) (*Result, error) {
 	return &Result{
 		AST:         root,
 		Warnings:    warnings,
+		Unknown:     unknown,
 		EscapeToken: d.escapeToken,
 	}, withLocation(handleScannerError(scanner.Err()), currentLine, 0)
 }
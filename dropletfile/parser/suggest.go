@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getopendroplet/droplet/dropletfile/command"
+)
+
+// maxSuggestionDistance is the maximum edit distance between an unknown
+// instruction and the instruction suggested for it, short instructions allow
+// one edit per three characters
+const maxSuggestionDistance = 2
+
+// UnknownInstruction is an instruction which isn't a Dropletfile command
+type UnknownInstruction struct {
+	Line        int
+	Instruction string
+	Suggestion  string // closest known instruction, empty if none is close
+	Location    []Range
+}
+
+func (e *UnknownInstruction) Error() string {
+	msg := fmt.Sprintf("unknown instruction: %s", strings.ToUpper(e.Instruction))
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %s?)", strings.ToUpper(e.Suggestion))
+	}
+	return msg
+}
+
+// SuggestInstruction returns the command closest to an unknown instruction,
+// or an empty string if no command is close enough
+func SuggestInstruction(instruction string) string {
+	instruction = strings.ToLower(instruction)
+
+	names := []string{}
+	for name := range command.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	suggestion := ""
+	best := maxSuggestionDistance + 1
+	for _, name := range names {
+		if d := editDistance(instruction, name); d < best && d*3 <= len(instruction) {
+			suggestion, best = name, d
+		}
+	}
+	return suggestion
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = smallest(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// smallest returns the smallest of some values
+func smallest(values ...int) int {
+	res := values[0]
+	for _, v := range values[1:] {
+		if v < res {
+			res = v
+		}
+	}
+	return res
+}
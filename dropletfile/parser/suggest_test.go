@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSuggestInstruction(t *testing.T) {
+	tests := map[string]string{
+		"RUN":      "run",
+		"rn":       "",
+		"RUNN":     "run",
+		"COPPY":    "copy",
+		"pakage":   "package",
+		"WORKDR":   "workdir",
+		"envv":     "env",
+		"xyz":      "",
+		"a":        "",
+		"complete": "",
+	}
+	for instruction, expected := range tests {
+		if res := SuggestInstruction(instruction); res != expected {
+			t.Errorf("%s: expected %q, got %q", instruction, expected, res)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"run", "run", 0},
+		{"run", "", 3},
+		{"runn", "run", 1},
+		{"rnu", "run", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, test := range tests {
+		if res := editDistance(test.a, test.b); res != test.expected {
+			t.Errorf("%s, %s: expected %d, got %d", test.a, test.b, test.expected, res)
+		}
+	}
+}
+
+func TestParseUnknownInstructions(t *testing.T) {
+	dropletfile := "STAGE install\nRUNN echo a\n  xyz b\nRUN echo c\n"
+
+	result, err := Parse(strings.NewReader(dropletfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.AST.Children) != 4 || len(result.Unknown) != 2 {
+		t.Fatalf("expected the unknown instructions to be kept, got %d and %d unknown", len(result.AST.Children), len(result.Unknown))
+	}
+
+	u := result.Unknown[0]
+	if u.Instruction != "runn" || u.Suggestion != "run" || u.Location[0].Start.Line != 2 {
+		t.Errorf("unexpected unknown instruction %+v", u)
+	}
+	u = result.Unknown[1]
+	if u.Suggestion != "" || u.Location[0].Start.Character != 2 || u.Location[0].End.Character != 5 {
+		t.Errorf("unexpected unknown instruction %+v", u)
+	}
+	expected := "[WARNING]: Ignoring line 2: unknown instruction: RUNN (did you mean RUN?)"
+	if len(result.Warnings) != 2 || result.Warnings[0] != expected {
+		t.Errorf("expected the warning %q, got %q", expected, result.Warnings)
+	}
+
+	_, err = ParseWithOptions(strings.NewReader(dropletfile), Options{Strict: true})
+	var unknown *UnknownInstruction
+	if !errors.As(err, &unknown) || unknown.Instruction != "runn" {
+		t.Errorf("expected the unknown instruction error in strict mode, got %v", err)
+	}
+}
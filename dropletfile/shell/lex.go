@@ -0,0 +1,278 @@
+// Package shell implements the word processing applied to Dropletfile
+// instruction arguments before they are handed to a builder.
+package shell
+
+import (
+	"bytes"
+	"strings"
+	"text/scanner"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// LookupFunc returns the value of a variable, and whether it is set.
+type LookupFunc func(name string) (string, bool)
+
+// UnsetFunc returns the value of an unset variable referenced without a
+// modifier.
+type UnsetFunc func(name string) (string, error)
+
+// Lex performs shell word splitting, quote removal and variable expansion on
+// Dropletfile words.
+type Lex struct {
+	escapeToken rune
+}
+
+// NewLex creates a new Lex which uses escapeToken to escape quotes.
+func NewLex(escapeToken rune) *Lex {
+	return &Lex{escapeToken: escapeToken}
+}
+
+// ProcessWord removes the quotes and escape tokens from word, expands the
+// variables found with lookup and returns the literal value it represents.
+//
+// Supported forms are $VAR, ${VAR}, ${VAR:-default}, ${VAR-default},
+// ${VAR:+alternative}, ${VAR+alternative}, ${VAR:?message} and
+// ${VAR?message}. An unset variable referenced without a modifier expands to
+// the value returned by unset, or to an empty string when unset is nil.
+func (s *Lex) ProcessWord(word string, lookup LookupFunc, unset UnsetFunc) (string, error) {
+	if lookup == nil {
+		lookup = func(string) (string, bool) { return "", false }
+	}
+	if unset == nil {
+		unset = func(string) (string, error) { return "", nil }
+	}
+	sw := &shellWord{
+		escapeToken: s.escapeToken,
+		lookup:      lookup,
+		unset:       unset,
+	}
+	sw.scanner.Init(strings.NewReader(word))
+	return sw.process(word)
+}
+
+type shellWord struct {
+	scanner     scanner.Scanner
+	escapeToken rune
+	lookup      LookupFunc
+	unset       UnsetFunc
+}
+
+func (sw *shellWord) process(source string) (string, error) {
+	word, err := sw.processStopOn(scanner.EOF)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to process %q", source)
+	}
+	return word, err
+}
+
+// processStopOn processes the word up to the stopChar (or EOF).
+func (sw *shellWord) processStopOn(stopChar rune) (string, error) {
+	var result bytes.Buffer
+
+	for sw.scanner.Peek() != scanner.EOF {
+		ch := sw.scanner.Peek()
+
+		if stopChar != scanner.EOF && ch == stopChar {
+			sw.scanner.Next()
+			return result.String(), nil
+		}
+
+		switch ch {
+		case '\'':
+			tmp, err := sw.processSingleQuote()
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(tmp)
+		case '"':
+			tmp, err := sw.processDoubleQuote()
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(tmp)
+		case '$':
+			tmp, err := sw.processDollar()
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(tmp)
+		default:
+			ch = sw.scanner.Next()
+			if ch == sw.escapeToken {
+				// '\' (default escape token, but ` allowed) escapes, except end of line
+				ch = sw.scanner.Next()
+				if ch == scanner.EOF {
+					break
+				}
+			}
+			result.WriteRune(ch)
+		}
+	}
+
+	if stopChar != scanner.EOF {
+		return "", errors.Errorf("unexpected end of statement while looking for matching %s", string(stopChar))
+	}
+	return result.String(), nil
+}
+
+func (sw *shellWord) processSingleQuote() (string, error) {
+	// All chars between single quotes are taken as-is
+	// Note, you can't escape '
+	var result bytes.Buffer
+
+	sw.scanner.Next()
+
+	for {
+		ch := sw.scanner.Next()
+		switch ch {
+		case scanner.EOF:
+			return "", errors.New("unexpected end of statement while looking for matching single-quote")
+		case '\'':
+			return result.String(), nil
+		}
+		result.WriteRune(ch)
+	}
+}
+
+func (sw *shellWord) processDoubleQuote() (string, error) {
+	// All chars up to the next " are taken as-is, even ', except any $ chars
+	// But you can escape " with a \ (or ` if escape token set accordingly)
+	var result bytes.Buffer
+
+	sw.scanner.Next()
+
+	for {
+		switch sw.scanner.Peek() {
+		case scanner.EOF:
+			return "", errors.New("unexpected end of statement while looking for matching double-quote")
+		case '"':
+			sw.scanner.Next()
+			return result.String(), nil
+		case '$':
+			value, err := sw.processDollar()
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(value)
+		default:
+			ch := sw.scanner.Next()
+			if ch == sw.escapeToken {
+				switch sw.scanner.Peek() {
+				case scanner.EOF:
+					// Ignore \ at end of word
+					continue
+				case '"', '$', sw.escapeToken:
+					// These chars can be escaped, all other \'s are left as-is
+					ch = sw.scanner.Next()
+				}
+			}
+			result.WriteRune(ch)
+		}
+	}
+}
+
+func (sw *shellWord) processDollar() (string, error) {
+	sw.scanner.Next()
+
+	// $xxx case
+	if sw.scanner.Peek() != '{' {
+		name := sw.processName()
+		if name == "" {
+			return "$", nil
+		}
+		return sw.getEnv(name)
+	}
+
+	sw.scanner.Next()
+	name := sw.processName()
+	if name == "" {
+		return "", errors.New("missing variable name in ${}")
+	}
+
+	ch := sw.scanner.Next()
+	switch ch {
+	case '}':
+		// Normal ${xx} case
+		return sw.getEnv(name)
+	case scanner.EOF:
+		return "", errors.New("syntax error: missing '}'")
+	}
+
+	// ${xx:...} checks for an empty value too
+	checkEmpty := false
+	if ch == ':' {
+		checkEmpty = true
+		ch = sw.scanner.Next()
+	}
+
+	word, err := sw.processStopOn('}')
+	if err != nil {
+		if sw.scanner.Peek() == scanner.EOF {
+			return "", errors.New("syntax error: missing '}'")
+		}
+		return "", err
+	}
+
+	value, set := sw.lookup(name)
+	if checkEmpty && value == "" {
+		set = false
+	}
+
+	switch ch {
+	case '-':
+		if !set {
+			return word, nil
+		}
+		return value, nil
+	case '+':
+		if set {
+			return word, nil
+		}
+		return "", nil
+	case '?':
+		if !set {
+			if word == "" {
+				word = "is not set"
+			}
+			return "", errors.Errorf("%s: %s", name, word)
+		}
+		return value, nil
+	default:
+		return "", errors.Errorf("unsupported modifier (%c) in substitution", ch)
+	}
+}
+
+func (sw *shellWord) processName() string {
+	// Read in a name (alphanumeric or _)
+	// If it starts with a numeric then just return $#
+	var name bytes.Buffer
+
+	for sw.scanner.Peek() != scanner.EOF {
+		ch := sw.scanner.Peek()
+		if name.Len() == 0 && unicode.IsDigit(ch) {
+			for sw.scanner.Peek() != scanner.EOF && unicode.IsDigit(sw.scanner.Peek()) {
+				// Keep reading until the first non-digit character, or EOF
+				ch = sw.scanner.Next()
+				name.WriteRune(ch)
+			}
+			return name.String()
+		}
+		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) && ch != '_' {
+			break
+		}
+		ch = sw.scanner.Next()
+		name.WriteRune(ch)
+	}
+
+	return name.String()
+}
+
+func (sw *shellWord) getEnv(name string) (string, error) {
+	value, ok := sw.lookup(name)
+	if !ok {
+		return sw.unset(name)
+	}
+	return value, nil
+}
@@ -0,0 +1,150 @@
+package shell
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProcessWord(t *testing.T) {
+	env := map[string]string{
+		"NAME":  "droplet",
+		"EMPTY": "",
+		"SPACE": "a b",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		word     string
+		expected string
+	}{
+		{`plain`, `plain`},
+		{`$NAME`, `droplet`},
+		{`${NAME}`, `droplet`},
+		{`pre-${NAME}-post`, `pre-droplet-post`},
+		{`$NAME.conf`, `droplet.conf`},
+		{`'$NAME'`, `$NAME`},
+		{`"$NAME"`, `droplet`},
+		{`"a  $SPACE"`, `a  a b`},
+		{`\$NAME`, `$NAME`},
+		{`"\$NAME"`, `$NAME`},
+		{`"a\b"`, `a\b`},
+		{`a\ b`, `a b`},
+		{`$`, `$`},
+		{`a$`, `a$`},
+		{`$1`, ``},
+		{`$UNSET`, ``},
+		{`${UNSET}`, ``},
+		{`${UNSET:-default}`, `default`},
+		{`${UNSET-default}`, `default`},
+		{`${EMPTY:-default}`, `default`},
+		{`${EMPTY-default}`, ``},
+		{`${NAME:-default}`, `droplet`},
+		{`${NAME:+alt}`, `alt`},
+		{`${NAME+alt}`, `alt`},
+		{`${EMPTY:+alt}`, ``},
+		{`${EMPTY+alt}`, `alt`},
+		{`${UNSET+alt}`, ``},
+		{`${UNSET:-$NAME}`, `droplet`},
+		{`${UNSET:-'a b'}`, `a b`},
+		{`${NAME:?required}`, `droplet`},
+	}
+
+	lex := NewLex('\\')
+	for _, test := range tests {
+		res, err := lex.ProcessWord(test.word, lookup, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.word, err)
+			continue
+		}
+		if res != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.word, test.expected, res)
+		}
+	}
+}
+
+func TestProcessWordErrors(t *testing.T) {
+	tests := []string{
+		`'unterminated`,
+		`"unterminated`,
+		`${NAME`,
+		`${}`,
+		`${NAME%suffix}`,
+		`${UNSET?}`,
+		`${UNSET:?message}`,
+	}
+
+	lex := NewLex('\\')
+	for _, word := range tests {
+		if res, err := lex.ProcessWord(word, nil, nil); err == nil {
+			t.Errorf("%s: expected an error, got %q", word, res)
+		}
+	}
+}
+
+func TestProcessWordEscapeToken(t *testing.T) {
+	lex := NewLex('`')
+	res, err := lex.ProcessWord("C:\\dir`$NAME", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `C:\dir$NAME` {
+		t.Errorf("expected %q, got %q", `C:\dir$NAME`, res)
+	}
+}
+
+func TestProcessWordUnset(t *testing.T) {
+	errRequired := errors.New("required")
+	unset := func(name string) (string, error) {
+		if name == "REQUIRED" {
+			return "", errRequired
+		}
+		return Ref(name), nil
+	}
+
+	lex := NewLex('\\')
+	res, err := lex.ProcessWord(`/opt/bin:$PATH`, nil, unset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "/opt/bin:"+Ref("PATH") {
+		t.Errorf("expected a reference to PATH, got %q", res)
+	}
+	if Source(res) != "/opt/bin:${PATH}" {
+		t.Errorf("expected /opt/bin:${PATH}, got %q", Source(res))
+	}
+
+	// Modifiers are resolved when building, without asking unset
+	res, err = lex.ProcessWord(`${REQUIRED:-default}`, nil, unset)
+	if err != nil || res != "default" {
+		t.Errorf("expected default, got %q, %v", res, err)
+	}
+
+	if _, err := lex.ProcessWord(`$REQUIRED`, nil, unset); !errors.Is(err, errRequired) {
+		t.Errorf("expected the error of unset, got %v", err)
+	}
+}
+
+func TestRefs(t *testing.T) {
+	word := "a" + Ref("X") + "b" + Ref("Y")
+	if !HasRefs(word) || HasRefs("a$X") {
+		t.Error("HasRefs doesn't find the references")
+	}
+	if StartsWithRef(word) || !StartsWithRef(Ref("HOME")+"/app") {
+		t.Error("StartsWithRef doesn't find the leading reference")
+	}
+
+	parts := SplitRefs(word)
+	expected := []string{"a", "X", "b", "Y", ""}
+	if len(parts) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, parts)
+	}
+	for i := range parts {
+		if parts[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected, parts)
+			break
+		}
+	}
+}
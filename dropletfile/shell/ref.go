@@ -0,0 +1,47 @@
+package shell
+
+import (
+	"strings"
+)
+
+// refDelim delimits the name of a variable left for the shell running the
+// script, a NUL can't be part of a Dropletfile word
+const refDelim = "\x00"
+
+// Ref returns the reference to a variable which is only known once the
+// script runs, it is kept in the expanded word until a builder quotes it.
+func Ref(name string) string {
+	return refDelim + name + refDelim
+}
+
+// HasRefs returns whether a word holds references to variables
+func HasRefs(s string) bool {
+	return strings.Contains(s, refDelim)
+}
+
+// StartsWithRef returns whether a word starts with a reference to a variable
+func StartsWithRef(s string) bool {
+	return strings.HasPrefix(s, refDelim)
+}
+
+// SplitRefs splits a word into its literal parts, at the even indexes, and
+// the names of the variables it references, at the odd indexes.
+func SplitRefs(s string) []string {
+	return strings.Split(s, refDelim)
+}
+
+// Source returns the word with its references written as ${name}
+func Source(s string) string {
+	if !HasRefs(s) {
+		return s
+	}
+
+	var b strings.Builder
+	for i, part := range SplitRefs(s) {
+		if i%2 == 1 {
+			part = "${" + part + "}"
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
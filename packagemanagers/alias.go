@@ -0,0 +1,59 @@
+package packagemanagers
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// AliasFile is the file of the config dir and of the workspace mapping the
+// packages of the PACKAGE instructions to their name for each package manager:
+//
+//	php:
+//	  apt: php-fpm
+//	  apk: php7
+const AliasFile = ".dropletpackages.yml"
+
+var (
+	aliases = map[string]map[string]string{}
+)
+
+// LoadAliases loads the package aliases of a file, an alias replaces the one
+// of the same package for the same package manager. A missing file defines
+// none.
+func LoadAliases(file string) error {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	loaded := map[string]map[string]string{}
+	if err := yaml.UnmarshalStrict(content, &loaded); err != nil {
+		return errors.Wrapf(err, "invalid package aliases %s", file)
+	}
+
+	for name, managers := range loaded {
+		if aliases[name] == nil {
+			aliases[name] = map[string]string{}
+		}
+		for manager, alias := range managers {
+			aliases[name][manager] = alias
+		}
+	}
+	return nil
+}
+
+// GetAliases returns the name of a package for each package manager.
+func GetAliases(name string) map[string]string {
+	return aliases[name]
+}
+
+// ClearAliases removes all the package aliases.
+func ClearAliases() {
+	aliases = map[string]map[string]string{}
+}
@@ -0,0 +1,64 @@
+package packagemanagers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// aliasTest loads the alias files with the given contents in order, the
+// aliases are cleared after the test
+func aliasTest(t *testing.T, contents ...string) error {
+	t.Helper()
+
+	ClearAliases()
+	t.Cleanup(ClearAliases)
+
+	dir, err := ioutil.TempDir("", "aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for i, content := range contents {
+		file := filepath.Join(dir, fmt.Sprintf("%d.yml", i))
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadAliases(file); err != nil {
+			return err
+		}
+	}
+	return LoadAliases(filepath.Join(dir, "missing"))
+}
+
+func TestLoadAliases(t *testing.T) {
+	err := aliasTest(t,
+		"php:\n  apt: php-fpm\n  apk: php7\nvim:\n  dnf: vim-enhanced\n",
+		"php:\n  apk: php8\n",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The aliases of the second file override the ones of the first file
+	tests := map[string]map[string]string{
+		"php":  {"apt": "php-fpm", "apk": "php8"},
+		"vim":  {"dnf": "vim-enhanced"},
+		"curl": nil,
+	}
+	for name, expected := range tests {
+		if res := GetAliases(name); !reflect.DeepEqual(res, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, res)
+		}
+	}
+}
+
+func TestLoadAliasesInvalid(t *testing.T) {
+	if err := aliasTest(t, "php: [apt]\n"); err == nil {
+		t.Errorf("expected an invalid %s error", AliasFile)
+	}
+}
@@ -2,19 +2,33 @@ package packagemanagers
 
 func init() {
 	AddManager("apk", &Manager{
-		commands: ManagerCommands{
-			install: "apk",
-			update:  "apk",
-			upgrade: "apk",
-			remove:  "apk",
-			clean:   "apk",
+		Commands: ManagerCommands{
+			Install: "apk",
+			Update:  "apk",
+			Upgrade: "apk",
+			Remove:  "apk",
+			Clean:   "apk",
 		},
-		flags: ManagerFlags{
-			install: []string{"add"},
-			update:  []string{"update"},
-			upgrade: []string{"upgrade"},
-			remove:  []string{"del", "--rdepends"},
-			global:  []string{"--no-cache"},
+		Flags: ManagerFlags{
+			Install: []string{"add"},
+			Update:  []string{"update"},
+			Upgrade: []string{"upgrade"},
+			Remove:  []string{"del", "--rdepends"},
+			Global:  []string{"--no-cache"},
+		},
+		Pin: ManagerPin{
+			Separator: "=",
+			Ranges:    true,
+		},
+		Repository: ManagerRepository{
+			Format: RepositoryApk,
+			Path:   "/etc/apk/repositories",
+			Keys:   "/etc/apk/keys",
+			Fetch:  "wget -qO",
+		},
+		Query: ManagerQuery{
+			Installed: `apk info -e {package} >/dev/null`,
+			Version:   `apk info -ev {package} | sed 's/^.*-\([^-]*-r[0-9]*\)$/\1/'`,
 		},
 	})
 }
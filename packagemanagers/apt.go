@@ -2,20 +2,37 @@ package packagemanagers
 
 func init() {
 	AddManager("apt", &Manager{
-		commands: ManagerCommands{
-			install: "apt",
-			update:  "apt",
-			upgrade: "apt",
-			remove:  "apt",
-			clean:   "apt",
+		Commands: ManagerCommands{
+			Install: "apt",
+			Update:  "apt",
+			Upgrade: "apt",
+			Remove:  "apt",
+			Clean:   "apt",
 		},
-		flags: ManagerFlags{
-			install: []string{"install"},
-			update:  []string{"update"},
-			upgrade: []string{"dist-upgrade"},
-			remove:  []string{"remove", "--auto-remove"},
-			clean:   []string{"clean"},
-			global:  []string{"-y"},
+		Flags: ManagerFlags{
+			Install:        []string{"install"},
+			Update:         []string{"update"},
+			Upgrade:        []string{"dist-upgrade"},
+			Remove:         []string{"remove", "--auto-remove"},
+			Clean:          []string{"clean"},
+			NonInteractive: []string{"-y"},
+		},
+		Env: ManagerEnv{
+			Global: map[string]string{"DEBIAN_FRONTEND": "noninteractive"},
+		},
+		Pin: ManagerPin{
+			Separator: "=",
+		},
+		Repository: ManagerRepository{
+			Format:  RepositoryDeb,
+			Path:    "/etc/apt/sources.list.d",
+			Keys:    "/etc/apt/keyrings",
+			Fetch:   "curl -fsSL -o",
+			Refresh: true,
+		},
+		Query: ManagerQuery{
+			Installed: `dpkg-query -W -f='${Status}' {package} 2>/dev/null | grep 'ok installed' >/dev/null`,
+			Version:   `dpkg-query -W -f='${db:Status-Abbrev} ${Version}' {package} | sed -n 's/^ii  *//p'`,
 		},
 	})
 }
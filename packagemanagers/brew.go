@@ -2,20 +2,27 @@ package packagemanagers
 
 func init() {
 	AddManager("brew", &Manager{
-		commands: ManagerCommands{
-			install: "brew",
-			update:  "brew",
-			upgrade: "brew",
-			remove:  "brew",
-			clean:   "brew",
+		Commands: ManagerCommands{
+			Install: "brew",
+			Update:  "brew",
+			Upgrade: "brew",
+			Remove:  "brew",
+			Clean:   "brew",
 		},
-		flags: ManagerFlags{
-			install: []string{"install"},
-			update:  []string{"update"},
-			upgrade: []string{"upgrade"},
-			remove:  []string{"remove"},
-			clean:   []string{"cleanup"},
-			global:  []string{"-f"},
+		Flags: ManagerFlags{
+			Install: []string{"install"},
+			Update:  []string{"update"},
+			Upgrade: []string{"upgrade"},
+			Remove:  []string{"remove"},
+			Clean:   []string{"cleanup"},
+			Global:  []string{"-f"},
+		},
+		Repository: ManagerRepository{
+			Format: RepositoryTap,
+		},
+		Query: ManagerQuery{
+			Installed: `brew list --versions {package} >/dev/null`,
+			Version:   `brew list --versions {package} | cut -d' ' -f2`,
 		},
 	})
 }
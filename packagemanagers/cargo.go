@@ -0,0 +1,25 @@
+package packagemanagers
+
+func init() {
+	AddManager("cargo", &Manager{
+		Commands: ManagerCommands{
+			Install: "cargo",
+			Remove:  "cargo",
+		},
+		Flags: ManagerFlags{
+			Install: []string{"install", "--locked"},
+			Remove:  []string{"uninstall"},
+		},
+		Pin: ManagerPin{
+			Separator: "@",
+		},
+		Query: ManagerQuery{
+			Installed: `{command} install --list | cut -d' ' -f1 | grep -xF {package} >/dev/null`,
+			Version:   `{command} install --list | awk -v p={package} '$1 == p { sub(/^v/, "", $2); sub(/:$/, "", $2); print $2 }'`,
+		},
+		Target: ManagerTarget{
+			Env: map[string]string{"CARGO_INSTALL_ROOT": "{target}"},
+		},
+		Language: true,
+	})
+}
@@ -2,20 +2,31 @@ package packagemanagers
 
 func init() {
 	AddManager("dnf", &Manager{
-		commands: ManagerCommands{
-			install: "dnf",
-			update:  "dnf",
-			upgrade: "dnf",
-			remove:  "dnf",
-			clean:   "dnf",
+		Commands: ManagerCommands{
+			Install: "dnf",
+			Update:  "dnf",
+			Upgrade: "dnf",
+			Remove:  "dnf",
+			Clean:   "dnf",
 		},
-		flags: ManagerFlags{
-			install: []string{"install"},
-			update:  []string{"makecache"},
-			upgrade: []string{"upgrade"},
-			remove:  []string{"remove"},
-			clean:   []string{"clean", "all"},
-			global:  []string{"-y"},
+		Flags: ManagerFlags{
+			Install:        []string{"install"},
+			Update:         []string{"makecache"},
+			Upgrade:        []string{"upgrade"},
+			Remove:         []string{"remove"},
+			Clean:          []string{"clean", "all"},
+			NonInteractive: []string{"-y"},
+		},
+		Pin: ManagerPin{
+			Separator: "-",
+		},
+		Repository: ManagerRepository{
+			Format: RepositoryRPMMD,
+			Path:   "/etc/yum.repos.d",
+		},
+		Query: ManagerQuery{
+			Installed: `rpm -q {package} >/dev/null 2>&1`,
+			Version:   `rpm -q --qf '%{VERSION}-%{RELEASE}' {package}`,
 		},
 	})
 }
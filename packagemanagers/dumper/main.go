@@ -14,5 +14,19 @@ func main() {
 		fmt.Println("\tUpgrade:", v.Upgrade())
 		fmt.Println("\tRemove:", v.Remove([]string{"a", "b", "c", "d"}, []string{}))
 		fmt.Println("\tClean:", v.Clean())
+		fmt.Println("\tIsInstalled:", v.IsInstalled("a"))
+		fmt.Println("\tInstalledVersion:", v.InstalledVersion("a"))
+
+		repository := packagemanagers.Repository{Name: "a", URL: "https://example.com/a", Key: "https://example.com/a.key"}
+		add, err := v.AddRepository(repository)
+		if err != nil {
+			add = err.Error()
+		}
+		fmt.Println("\tAddRepository:", add)
+		remove, err := v.RemoveRepository(repository)
+		if err != nil {
+			remove = err.Error()
+		}
+		fmt.Println("\tRemoveRepository:", remove)
 	}
 }
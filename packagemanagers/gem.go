@@ -0,0 +1,29 @@
+package packagemanagers
+
+func init() {
+	AddManager("gem", &Manager{
+		Commands: ManagerCommands{
+			Install: "gem",
+			Upgrade: "gem",
+			Remove:  "gem",
+			Clean:   "gem",
+		},
+		Flags: ManagerFlags{
+			Install: []string{"install", "--no-document"},
+			Upgrade: []string{"update", "--no-document"},
+			Remove:  []string{"uninstall", "--all", "--executables"},
+			Clean:   []string{"cleanup"},
+		},
+		Pin: ManagerPin{
+			Separator: ":",
+		},
+		Query: ManagerQuery{
+			Installed: `{command} list -i -e {package} >/dev/null`,
+			Version:   `{command} list -e {package} | sed -n 's/^[^ ]* (\([^ ,)]*\).*/\1/p'`,
+		},
+		Target: ManagerTarget{
+			Env: map[string]string{"GEM_HOME": "{target}"},
+		},
+		Language: true,
+	})
+}
@@ -0,0 +1,23 @@
+package packagemanagers
+
+func init() {
+	AddManager("go", &Manager{
+		Commands: ManagerCommands{
+			Install: "go",
+			Clean:   "go",
+		},
+		Flags: ManagerFlags{
+			Install: []string{"install"},
+			Clean:   []string{"clean", "-modcache"},
+		},
+		Pin: ManagerPin{
+			Separator: "@",
+			Default:   "latest",
+		},
+		Target: ManagerTarget{
+			Env: map[string]string{"GOBIN": "{target}"},
+		},
+		Language:   true,
+		OnePackage: true,
+	})
+}
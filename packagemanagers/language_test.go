@@ -0,0 +1,92 @@
+package packagemanagers
+
+import (
+	"testing"
+)
+
+func TestLanguageManagers(t *testing.T) {
+	tests := []struct {
+		manager, install, remove string
+	}{
+		{"pip", "python3 -m pip --no-input --disable-pip-version-check install flask requests", "python3 -m pip --no-input --disable-pip-version-check uninstall -y flask requests"},
+		{"npm", "npm --global install flask requests", "npm --global uninstall flask requests"},
+		{"gem", "gem install --no-document flask requests", "gem uninstall --all --executables flask requests"},
+		{"cargo", "cargo install --locked flask requests", "cargo uninstall flask requests"},
+		{"go", "go install flask && go install requests", ""},
+	}
+	for _, test := range tests {
+		m := GetManager(test.manager)
+		if !m.Language {
+			t.Errorf("%s: expected a language package manager", test.manager)
+		}
+		if res := m.Install([]string{"flask", "requests"}, nil); res != test.install {
+			t.Errorf("%s: expected the install %q, got %q", test.manager, test.install, res)
+		}
+		if res := m.Remove([]string{"flask", "requests"}, nil); res != test.remove {
+			t.Errorf("%s: expected the remove %q, got %q", test.manager, test.remove, res)
+		}
+	}
+
+	for _, name := range []string{"apk", "apt", "brew", "dnf", "pacman", "yum", "zypper"} {
+		if GetManager(name).Language {
+			t.Errorf("%s: expected a system package manager", name)
+		}
+	}
+}
+
+func TestWithTarget(t *testing.T) {
+	tests := []struct {
+		manager, install, installed string
+	}{
+		{
+			"pip",
+			"{ [ -d '/opt/my app' ] || python3 -m venv '/opt/my app'; } && '/opt/my app'/bin/python -m pip --no-input --disable-pip-version-check install flask",
+			"'/opt/my app'/bin/python -m pip --disable-pip-version-check show flask >/dev/null 2>&1",
+		},
+		{
+			"npm",
+			"npm --prefix '/opt/my app' install flask",
+			"npm --prefix '/opt/my app' ls --depth=0 flask >/dev/null 2>&1",
+		},
+		{
+			"gem",
+			"GEM_HOME='/opt/my app' gem install --no-document flask",
+			"GEM_HOME='/opt/my app' gem list -i -e flask >/dev/null",
+		},
+		{
+			"cargo",
+			"CARGO_INSTALL_ROOT='/opt/my app' cargo install --locked flask",
+			"CARGO_INSTALL_ROOT='/opt/my app' cargo install --list | cut -d' ' -f1 | grep -xF flask >/dev/null",
+		},
+		{
+			"go",
+			"GOBIN='/opt/my app' go install flask",
+			"",
+		},
+	}
+	for _, test := range tests {
+		m, err := GetManager(test.manager).WithTarget("/opt/my app")
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.manager, err)
+			continue
+		}
+		if res := m.Install([]string{"flask"}, nil); res != test.install {
+			t.Errorf("%s: expected the install %q, got %q", test.manager, test.install, res)
+		}
+		if res := m.IsInstalled("flask"); res != test.installed {
+			t.Errorf("%s: expected the query %q, got %q", test.manager, test.installed, res)
+		}
+
+		// The package manager installing to the system is unchanged
+		if GetManager(test.manager).Install([]string{"flask"}, nil) == test.install {
+			t.Errorf("%s: the target changed the system package manager", test.manager)
+		}
+	}
+
+	for _, name := range []string{"apt", "brew"} {
+		_, err := GetManager(name).WithTarget("/opt/app")
+		if err == nil || err.Error() != "install targets aren't supported, can't install to /opt/app" {
+			t.Errorf("%s: expected the unsupported target error, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package packagemanagers
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ManagersDir is the dir of the config dir and of the workspace holding the
+// package manager definitions, a <name>.yml file per package manager:
+//
+//	commands:
+//	  install: apt-get
+//	  update: apt-get
+//	flags:
+//	  install: [install, --no-install-recommends]
+//	  update: [update]
+//	  non_interactive: [-y]
+//	env:
+//	  global:
+//	    DEBIAN_FRONTEND: noninteractive
+//	pin:
+//	  separator: "="
+//	repository:
+//	  format: deb
+//	  path: /etc/apt/sources.list.d
+//	  keys: /etc/apt/keyrings
+//	  fetch: curl -fsSL -o
+//	  refresh: true
+const ManagersDir = "package-managers"
+
+var reManagerName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// LoadManagers loads the package managers defined in the YAML files of a dir,
+// a definition replaces the package manager of the same name. A missing dir
+// defines none.
+func LoadManagers(dir string) error {
+	files := []string{}
+	for _, ext := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, ext))
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if !reManagerName.MatchString(name) {
+			return errors.Errorf("invalid package manager name %q in %s, only lowercase letters, digits, '_' and '-' are allowed", name, file)
+		}
+
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		manager := &Manager{}
+		if err := yaml.UnmarshalStrict(content, manager); err != nil {
+			return errors.Wrapf(err, "invalid package manager %s", file)
+		}
+		if err := manager.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid package manager %s", file)
+		}
+		manager.Source = file
+
+		DeleteManager(name)
+		AddManager(name, manager)
+	}
+	return nil
+}
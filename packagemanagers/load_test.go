@@ -0,0 +1,161 @@
+package packagemanagers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// loadTest loads the package managers defined by files, the built-in package
+// managers are restored after the test
+func loadTest(t *testing.T, files map[string]string) (string, error) {
+	t.Helper()
+
+	builtin := map[string]*Manager{}
+	for name, manager := range managers {
+		builtin[name] = manager
+	}
+	t.Cleanup(func() { managers = builtin })
+
+	dir, err := ioutil.TempDir("", "managers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, LoadManagers(dir)
+}
+
+func TestLoadManagers(t *testing.T) {
+	dir, err := loadTest(t, map[string]string{
+		"apt.yml": `commands:
+  install: apt-get
+  update: apt-get
+flags:
+  install: [install, --no-install-recommends]
+  update: [update]
+  non_interactive: [-y]
+env:
+  global:
+    DEBIAN_FRONTEND: noninteractive
+pin:
+  separator: "="
+repository:
+  format: deb
+  path: /etc/apt/sources.list.d
+  keys: /etc/apt/keyrings
+  fetch: curl -fsSL -o
+  refresh: true
+`,
+		"xbps.yaml": `commands:
+  install: xbps-install
+  remove: xbps-remove
+flags:
+  install: [-S]
+  remove: [-R]
+  non_interactive: [-y]
+`,
+		"README.md": "not a package manager",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apt := GetManager("apt")
+	if apt.Source != filepath.Join(dir, "apt.yml") {
+		t.Errorf("expected apt to be loaded from %s, got %q", filepath.Join(dir, "apt.yml"), apt.Source)
+	}
+	if res := apt.Install([]string{"curl"}, nil); res != "DEBIAN_FRONTEND=noninteractive apt-get -y install --no-install-recommends curl" {
+		t.Errorf("unexpected apt install %q", res)
+	}
+	if res, _ := apt.PinPackage("curl", "7.74*"); res != "curl=7.74*" {
+		t.Errorf("unexpected apt pin %q", res)
+	}
+
+	xbps := GetManager("xbps")
+	if xbps == nil {
+		t.Fatal("xbps isn't loaded")
+	}
+	if res := xbps.Remove([]string{"vim"}, nil); res != "xbps-remove -y -R vim" {
+		t.Errorf("unexpected xbps remove %q", res)
+	}
+	if xbps.Update() != "" || xbps.Repository.Format != "" {
+		t.Errorf("expected xbps to update nothing and support no repository, got %+v", xbps)
+	}
+
+	if GetManager("apk").Source != "" || ExistsManager("README") {
+		t.Error("expected only the YAML files to be loaded")
+	}
+}
+
+func TestLoadManagersBuiltin(t *testing.T) {
+	// The built-in package managers dumped to YAML load back unchanged
+	files := map[string]string{}
+	builtin := map[string]Manager{}
+	for name, manager := range Managers() {
+		content, err := yaml.Marshal(manager)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name+".yml"] = string(content)
+		builtin[name] = *manager
+	}
+	dir, err := loadTest(t, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, manager := range builtin {
+		loaded := *GetManager(name)
+		if loaded.Source != filepath.Join(dir, name+".yml") {
+			t.Errorf("%s: expected to be loaded from %s, got %q", name, filepath.Join(dir, name+".yml"), loaded.Source)
+		}
+		loaded.Source = ""
+		if !reflect.DeepEqual(loaded, manager) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", name, manager, loaded)
+		}
+	}
+}
+
+func TestLoadManagersMissingDir(t *testing.T) {
+	if err := LoadManagers(filepath.Join(os.TempDir(), "droplet-missing-managers")); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestLoadManagersErrors(t *testing.T) {
+	tests := []struct {
+		file, content, expected string
+	}{
+		{"Apt.yml", "commands:\n  install: apt\nflags:\n  install: [install]\n", `invalid package manager name "Apt"`},
+		{"apt.yml", "commands:\n  install: apt\n  instal: apt\nflags:\n  install: [install]\n", "field instal not found"},
+		{"apt.yml", "commands: apt\n", "cannot unmarshal"},
+		{"apt.yml", "commands:\n  update: apt\nflags:\n  update: [update]\n", "the install command and flags are required"},
+		{"apt.yml", "commands:\n  install: apt\n", "the install command and flags are required"},
+		{"apt.yml", "commands:\n  install: apt\nflags:\n  install: [install]\nrepository:\n  format: rpm\n", "unknown repository format rpm, expected deb, rpm-md, apk or tap"},
+		{"apt.yml", "commands:\n  install: apt\nflags:\n  install: [install]\nenv:\n  global:\n    DEBIAN-FRONTEND: noninteractive\n", `invalid env var name "DEBIAN-FRONTEND"`},
+	}
+	for _, test := range tests {
+		builtin := GetManager("apt")
+		_, err := loadTest(t, map[string]string{test.file: test.content})
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected the error %q, got %v", test.content, test.expected, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), test.file) {
+			t.Errorf("%s: expected the error to name the file, got %v", test.content, err)
+		}
+		if GetManager("apt") != builtin {
+			t.Errorf("%s: an invalid definition replaced apt", test.content)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package packagemanagers
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
 var (
@@ -11,87 +14,298 @@ var (
 
 // ManagerCommands represents all commands.
 type ManagerCommands struct {
-	install string
-	update  string
-	upgrade string
-	remove  string
-	clean   string
+	Install string `yaml:"install,omitempty"`
+	Update  string `yaml:"update,omitempty"`
+	Upgrade string `yaml:"upgrade,omitempty"`
+	Remove  string `yaml:"remove,omitempty"`
+	Clean   string `yaml:"clean,omitempty"`
 }
 
-// ManagerFlags represents flags for all subcommands of a package manager.
+// ManagerFlags represents flags for all subcommands of a package manager, a
+// subcommand without flags isn't supported.
 type ManagerFlags struct {
-	install []string
-	update  []string
-	upgrade []string
-	remove  []string
-	clean   []string
-	global  []string
+	Install        []string `yaml:"install,omitempty"`
+	Update         []string `yaml:"update,omitempty"`
+	Upgrade        []string `yaml:"upgrade,omitempty"`
+	Remove         []string `yaml:"remove,omitempty"`
+	Clean          []string `yaml:"clean,omitempty"`
+	Global         []string `yaml:"global,omitempty"`
+	NonInteractive []string `yaml:"non_interactive,omitempty"` // answer yes to the prompts
+}
+
+// ManagerEnv represents the env vars set for all subcommands of a package
+// manager.
+type ManagerEnv struct {
+	Install map[string]string `yaml:"install,omitempty"`
+	Update  map[string]string `yaml:"update,omitempty"`
+	Upgrade map[string]string `yaml:"upgrade,omitempty"`
+	Remove  map[string]string `yaml:"remove,omitempty"`
+	Clean   map[string]string `yaml:"clean,omitempty"`
+	Global  map[string]string `yaml:"global,omitempty"`
+}
+
+// ManagerPin represents the version pinning syntax of a package manager.
+type ManagerPin struct {
+	Separator string `yaml:"separator,omitempty"` // between the package and its version, empty when pinning isn't supported
+	Ranges    bool   `yaml:"ranges,omitempty"`    // whether versions like >=1.2 are supported
+	Default   string `yaml:"default,omitempty"`   // version of the packages without one
+}
+
+// ManagerQuery represents the commands querying the installed packages,
+// {package} is replaced by the package and {command} by the install command
+// with its env vars and global flags.
+type ManagerQuery struct {
+	Installed string `yaml:"installed,omitempty"` // succeeds when the package is installed
+	Version   string `yaml:"version,omitempty"`   // prints the installed version of the package
+}
+
+// ManagerTarget represents how a package manager installs packages to a
+// target dir instead of the system, {target} is replaced by the dir.
+type ManagerTarget struct {
+	Create  string            `yaml:"create,omitempty"`  // creates the target dir when missing
+	Command string            `yaml:"command,omitempty"` // replaces the commands
+	Global  []string          `yaml:"global,omitempty"`  // replaces the global flags
+	Env     map[string]string `yaml:"env,omitempty"`     // set for all subcommands
 }
 
 // A Manager represents a package manager.
 type Manager struct {
-	Comment  string
-	commands ManagerCommands
-	flags    ManagerFlags
+	Comment    string            `yaml:"comment,omitempty"`
+	Commands   ManagerCommands   `yaml:"commands"`
+	Flags      ManagerFlags      `yaml:"flags"`
+	Env        ManagerEnv        `yaml:"env,omitempty"`
+	Pin        ManagerPin        `yaml:"pin,omitempty"`
+	Repository ManagerRepository `yaml:"repository,omitempty"`
+	Query      ManagerQuery      `yaml:"query,omitempty"`
+	Target     ManagerTarget     `yaml:"target,omitempty"`
+	Language   bool              `yaml:"language,omitempty"`    // installs the packages of a language, never detected as the system package manager
+	OnePackage bool              `yaml:"one_package,omitempty"` // installs or removes a single package per command
+	Source     string            `yaml:"-"`                     // file the manager is loaded from, empty when built in
+	prepare    string            // runs before every subcommand
 }
 
-// Install installs packages to the system.
-func (m Manager) Install(packages []string, flags []string) string {
-	if len(m.flags.install) == 0 || packages == nil || len(packages) == 0 {
-		return ""
+// PinPackage returns a package pinned to a version, in the syntax of the
+// manager.
+func (m Manager) PinPackage(name string, version string) (string, error) {
+	if version == "" {
+		version = m.Pin.Default
+	}
+	if version == "" {
+		return name, nil
+	}
+	if m.Pin.Separator == "" {
+		return "", errors.Errorf("version pinning isn't supported, can't install %s@%s", name, version)
+	}
+
+	if strings.ContainsAny(version[:1], "<>=~") {
+		if !m.Pin.Ranges {
+			return "", errors.Errorf("version ranges aren't supported, can't install %s@%s", name, version)
+		}
+		return name + version, nil
+	}
+	return name + m.Pin.Separator + version, nil
+}
+
+// SplitPinned splits a package pinned with the syntax of the manager, like
+// requests==2.31 for pip, into its name and version. The version is empty
+// when the package isn't pinned, or when the separator may be part of the
+// name like the - of dnf. Version ranges keep their operator.
+func (m Manager) SplitPinned(p string) (string, string) {
+	sep := m.Pin.Separator
+	if sep == "" || strings.ContainsAny(sep, "-@") {
+		return p, ""
+	}
+
+	i := strings.Index(p, sep)
+	if m.Pin.Ranges {
+		if j := strings.IndexAny(p, "<>=~!"); j >= 0 && (i < 0 || j < i) {
+			i = j
+		}
+	}
+	if i <= 0 {
+		return p, ""
+	}
+	return p[:i], strings.TrimPrefix(p[i:], sep)
+}
+
+// WithTarget returns the package manager installing the packages to a target
+// dir, like a virtualenv or a prefix, instead of the system.
+func (m Manager) WithTarget(dir string) (*Manager, error) {
+	t := m.Target
+	if t.Create == "" && t.Command == "" && t.Global == nil && t.Env == nil {
+		return nil, errors.Errorf("install targets aren't supported, can't install to %s", dir)
+	}
+
+	target := func(s string) string {
+		return strings.Replace(s, "{target}", quote(dir), -1)
 	}
 
-	args := append(m.flags.global, m.flags.install...)
-	args = append(args, flags...)
-	args = append(args, packages...)
+	if t.Command != "" {
+		m.Commands = ManagerCommands{
+			Install: target(t.Command),
+			Update:  target(t.Command),
+			Upgrade: target(t.Command),
+			Remove:  target(t.Command),
+			Clean:   target(t.Command),
+		}
+	}
+	if t.Global != nil {
+		m.Flags.Global = make([]string, len(t.Global))
+		for i, flag := range t.Global {
+			m.Flags.Global[i] = target(flag)
+		}
+	}
+	if t.Env != nil {
+		env := map[string]string{}
+		for k, v := range m.Env.Global {
+			env[k] = v
+		}
+		for k, v := range t.Env {
+			env[k] = strings.Replace(v, "{target}", dir, -1)
+		}
+		m.Env.Global = env
+	}
+	if t.Create != "" {
+		m.prepare = fmt.Sprintf("{ [ -d %s ] || %s; }", quote(dir), target(t.Create))
+	}
 
-	return fmt.Sprintf("%s %s", m.commands.install, strings.Join(args, " "))
+	return &m, nil
 }
 
-// Update updates all packages.
-func (m Manager) Update() string {
-	if len(m.flags.update) == 0 {
+// IsInstalled returns the command succeeding when a package is installed,
+// empty when the manager can't query it.
+func (m Manager) IsInstalled(name string) string {
+	return m.query(m.Query.Installed, name)
+}
+
+// InstalledVersion returns the command printing the installed version of a
+// package, empty when the manager can't query it.
+func (m Manager) InstalledVersion(name string) string {
+	return m.query(m.Query.Version, name)
+}
+
+func (m Manager) query(query string, name string) string {
+	if query == "" {
 		return ""
 	}
 
-	args := append(m.flags.global, m.flags.update...)
+	command := strings.Join(append(append(m.env(nil), m.Commands.Install), m.Flags.Global...), " ")
+	return strings.NewReplacer("{command}", command, "{package}", quote(name)).Replace(query)
+}
+
+// command returns a subcommand with its env vars and flags, empty when the
+// subcommand isn't supported.
+func (m Manager) command(command string, env map[string]string, flags []string, args ...string) string {
+	if len(flags) == 0 {
+		return ""
+	}
 
-	return fmt.Sprintf("%s %s", m.commands.update, strings.Join(args, " "))
+	words := m.env(env)
+	words = append(words, command)
+	words = append(words, m.Flags.NonInteractive...)
+	words = append(words, m.Flags.Global...)
+	words = append(words, flags...)
+	words = append(words, args...)
+
+	if m.prepare != "" {
+		return m.prepare + " && " + strings.Join(words, " ")
+	}
+	return strings.Join(words, " ")
 }
 
-// Upgrade upgradees the package database.
-func (m Manager) Upgrade() string {
-	if len(m.flags.upgrade) == 0 {
+// env returns the assignments of the global env vars and of the env vars of a
+// subcommand.
+func (m Manager) env(env map[string]string) []string {
+	vars := map[string]string{}
+	for _, e := range []map[string]string{m.Env.Global, env} {
+		for k, v := range e {
+			vars[k] = v
+		}
+	}
+	keys := []string{}
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	words := []string{}
+	for _, k := range keys {
+		words = append(words, k+"="+quote(vars[k]))
+	}
+	return words
+}
+
+// eachPackage returns a subcommand for the packages, or one per package when
+// the manager only takes a single package.
+func (m Manager) eachPackage(command string, env map[string]string, flags []string, extra []string, packages []string) string {
+	if !m.OnePackage {
+		return m.command(command, env, flags, append(append([]string{}, extra...), packages...)...)
+	}
+
+	cmds := []string{}
+	for _, p := range packages {
+		cmd := m.command(command, env, flags, append(append([]string{}, extra...), p)...)
+		if cmd == "" {
+			return ""
+		}
+		cmds = append(cmds, cmd)
+	}
+	return strings.Join(cmds, " && ")
+}
+
+// Install installs packages to the system.
+func (m Manager) Install(packages []string, flags []string) string {
+	if len(packages) == 0 {
 		return ""
 	}
 
-	args := append(m.flags.global, m.flags.upgrade...)
+	return m.eachPackage(m.Commands.Install, m.Env.Install, m.Flags.Install, flags, packages)
+}
 
-	return fmt.Sprintf("%s %s", m.commands.upgrade, strings.Join(args, " "))
+// Update updates all packages.
+func (m Manager) Update() string {
+	return m.command(m.Commands.Update, m.Env.Update, m.Flags.Update)
+}
+
+// Upgrade upgradees the package database.
+func (m Manager) Upgrade() string {
+	return m.command(m.Commands.Upgrade, m.Env.Upgrade, m.Flags.Upgrade)
 }
 
 // Remove removes packages from the system.
 func (m Manager) Remove(packages []string, flags []string) string {
-	if len(m.flags.remove) == 0 || packages == nil || len(packages) == 0 {
+	if len(packages) == 0 {
 		return ""
 	}
 
-	args := append(m.flags.global, m.flags.remove...)
-	args = append(args, flags...)
-	args = append(args, packages...)
-
-	return fmt.Sprintf("%s %s", m.commands.remove, strings.Join(args, " "))
+	return m.eachPackage(m.Commands.Remove, m.Env.Remove, m.Flags.Remove, flags, packages)
 }
 
 // Clean cleans up cached files used by the package managers.
 func (m Manager) Clean() string {
-	if len(m.flags.clean) == 0 {
-		return ""
+	return m.command(m.Commands.Clean, m.Env.Clean, m.Flags.Clean)
+}
+
+// Validate checks the definition of a package manager.
+func (m Manager) Validate() error {
+	if m.Commands.Install == "" || len(m.Flags.Install) == 0 {
+		return errors.New("the install command and flags are required")
 	}
 
-	args := append(m.flags.global, m.flags.clean...)
+	switch m.Repository.Format {
+	case "", RepositoryDeb, RepositoryRPMMD, RepositoryApk, RepositoryTap:
+	default:
+		return errors.Errorf("unknown repository format %s, expected %s, %s, %s or %s", m.Repository.Format, RepositoryDeb, RepositoryRPMMD, RepositoryApk, RepositoryTap)
+	}
 
-	return fmt.Sprintf("%s %s", m.commands.clean, strings.Join(args, " "))
+	for _, env := range []map[string]string{m.Env.Install, m.Env.Update, m.Env.Upgrade, m.Env.Remove, m.Env.Clean, m.Env.Global, m.Target.Env} {
+		for k := range env {
+			if !reEnvName.MatchString(k) {
+				return errors.Errorf("invalid env var name %q", k)
+			}
+		}
+	}
+	return nil
 }
 
 // AddManager add manager.
@@ -0,0 +1,77 @@
+package packagemanagers
+
+import (
+	"testing"
+)
+
+func TestPinPackage(t *testing.T) {
+	tests := []struct {
+		manager, name, version, expected string
+	}{
+		{"apt", "nginx", "", "nginx"},
+		{"apt", "nginx", "1.18*", "nginx=1.18*"},
+		{"apk", "nginx", ">=1.18", "nginx>=1.18"},
+		{"apk", "nginx", "~1.18", "nginx~1.18"},
+		{"dnf", "nginx", "1.18.0", "nginx-1.18.0"},
+		{"yum", "nginx", "1.18.0", "nginx-1.18.0"},
+		{"zypper", "nginx", "<1.19", "nginx<1.19"},
+		{"pip", "flask", "1.1.2", "flask==1.1.2"},
+		{"pip", "flask", ">=1.1", "flask>=1.1"},
+		{"npm", "@angular/cli", "12.0.0", "@angular/cli@12.0.0"},
+		{"gem", "rails", "6.1.3", "rails:6.1.3"},
+		{"cargo", "ripgrep", "12.1.1", "ripgrep@12.1.1"},
+		{"go", "golang.org/x/tools/gopls", "", "golang.org/x/tools/gopls@latest"},
+		{"go", "golang.org/x/tools/gopls", "v0.6.6", "golang.org/x/tools/gopls@v0.6.6"},
+	}
+	for _, test := range tests {
+		res, err := GetManager(test.manager).PinPackage(test.name, test.version)
+		if err != nil {
+			t.Errorf("%s %s@%s: unexpected error %v", test.manager, test.name, test.version, err)
+			continue
+		}
+		if res != test.expected {
+			t.Errorf("%s %s@%s: expected %q, got %q", test.manager, test.name, test.version, test.expected, res)
+		}
+	}
+}
+
+func TestPinPackageErrors(t *testing.T) {
+	tests := []struct {
+		manager, version, expected string
+	}{
+		{"pacman", "1.18", "version pinning isn't supported, can't install nginx@1.18"},
+		{"brew", "1.18", "version pinning isn't supported, can't install nginx@1.18"},
+		{"apt", ">=1.18", "version ranges aren't supported, can't install nginx@>=1.18"},
+		{"dnf", "<1.19", "version ranges aren't supported, can't install nginx@<1.19"},
+	}
+	for _, test := range tests {
+		_, err := GetManager(test.manager).PinPackage("nginx", test.version)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%s: expected the error %q, got %v", test.manager, test.expected, err)
+		}
+	}
+}
+
+func TestSplitPinned(t *testing.T) {
+	tests := []struct {
+		manager, pkg, name, version string
+	}{
+		{"pip", "requests", "requests", ""},
+		{"pip", "requests==2.31", "requests", "2.31"},
+		{"pip", "requests>=2.31", "requests", ">=2.31"},
+		{"pip", "requests~=2.31", "requests", "~=2.31"},
+		{"apt", "vim=2:8.2*", "vim", "2:8.2*"},
+		{"apk", "nginx=1.18.0-r1", "nginx", "1.18.0-r1"},
+		{"apk", "nginx~1.18", "nginx", "~1.18"},
+		{"gem", "rails:6.1.3", "rails", "6.1.3"},
+		{"dnf", "php-fpm", "php-fpm", ""},
+		{"npm", "@angular/cli", "@angular/cli", ""},
+		{"pacman", "nginx", "nginx", ""},
+	}
+	for _, test := range tests {
+		name, version := GetManager(test.manager).SplitPinned(test.pkg)
+		if name != test.name || version != test.version {
+			t.Errorf("%s %s: expected %q %q, got %q %q", test.manager, test.pkg, test.name, test.version, name, version)
+		}
+	}
+}
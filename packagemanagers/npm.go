@@ -0,0 +1,30 @@
+package packagemanagers
+
+func init() {
+	AddManager("npm", &Manager{
+		Commands: ManagerCommands{
+			Install: "npm",
+			Upgrade: "npm",
+			Remove:  "npm",
+			Clean:   "npm",
+		},
+		Flags: ManagerFlags{
+			Install: []string{"install"},
+			Upgrade: []string{"update"},
+			Remove:  []string{"uninstall"},
+			Clean:   []string{"cache", "clean", "--force"},
+			Global:  []string{"--global"},
+		},
+		Pin: ManagerPin{
+			Separator: "@",
+		},
+		Query: ManagerQuery{
+			Installed: `{command} ls --depth=0 {package} >/dev/null 2>&1`,
+			Version:   `{command} ls --depth=0 {package} | sed -n 's/.*@\([^@ ]*\)$/\1/p'`,
+		},
+		Target: ManagerTarget{
+			Global: []string{"--prefix", "{target}"},
+		},
+		Language: true,
+	})
+}
@@ -2,20 +2,24 @@ package packagemanagers
 
 func init() {
 	AddManager("pacman", &Manager{
-		commands: ManagerCommands{
-			install: "pacman",
-			update:  "pacman",
-			upgrade: "pacman",
-			remove:  "pacman",
-			clean:   "pacman",
+		Commands: ManagerCommands{
+			Install: "pacman",
+			Update:  "pacman",
+			Upgrade: "pacman",
+			Remove:  "pacman",
+			Clean:   "pacman",
 		},
-		flags: ManagerFlags{
-			install: []string{"-S", "--needed"},
-			update:  []string{"-Syy"},
-			upgrade: []string{"-Su"},
-			remove:  []string{"-Rcs"},
-			clean:   []string{"-Sc"},
-			global:  []string{"--noconfirm"},
+		Flags: ManagerFlags{
+			Install:        []string{"-S", "--needed"},
+			Update:         []string{"-Syy"},
+			Upgrade:        []string{"-Su"},
+			Remove:         []string{"-Rcs"},
+			Clean:          []string{"-Sc"},
+			NonInteractive: []string{"--noconfirm"},
+		},
+		Query: ManagerQuery{
+			Installed: `pacman -Q {package} >/dev/null 2>&1`,
+			Version:   `pacman -Q {package} | cut -d' ' -f2`,
 		},
 	})
 }
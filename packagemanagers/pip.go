@@ -0,0 +1,31 @@
+package packagemanagers
+
+func init() {
+	AddManager("pip", &Manager{
+		Commands: ManagerCommands{
+			Install: "python3 -m pip",
+			Remove:  "python3 -m pip",
+			Clean:   "python3 -m pip",
+		},
+		Flags: ManagerFlags{
+			Install:        []string{"install"},
+			Remove:         []string{"uninstall", "-y"},
+			Clean:          []string{"cache", "purge"},
+			Global:         []string{"--disable-pip-version-check"},
+			NonInteractive: []string{"--no-input"},
+		},
+		Pin: ManagerPin{
+			Separator: "==",
+			Ranges:    true,
+		},
+		Query: ManagerQuery{
+			Installed: `{command} show {package} >/dev/null 2>&1`,
+			Version:   `{command} show {package} | sed -n 's/^Version: //p'`,
+		},
+		Target: ManagerTarget{
+			Create:  "python3 -m venv {target}",
+			Command: "{target}/bin/python -m pip",
+		},
+		Language: true,
+	})
+}
@@ -0,0 +1,222 @@
+package packagemanagers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Formats of the package repositories
+const (
+	RepositoryDeb   = "deb"    // apt sources.list.d file and keyring
+	RepositoryRPMMD = "rpm-md" // dnf, yum and zypper .repo file
+	RepositoryApk   = "apk"    // line of /etc/apk/repositories and key, the name is unused
+	RepositoryTap   = "tap"    // brew tap
+)
+
+var (
+	reShellSafe      = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+	reRepositoryName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	reRepositoryID   = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+	reEnvName        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// codename is the codename of the target, the default suite of a deb repository
+const codename = `"$(. /etc/os-release && echo "$VERSION_CODENAME")"`
+
+// A Repository represents a third-party package repository.
+type Repository struct {
+	Name       string   // name of the repository file, or tap of brew
+	URL        string   // base URL of the repository
+	Key        string   // URL of the signing key
+	Suite      string   // deb suite, defaults to the codename of the target
+	Components []string // deb components, defaults to main
+}
+
+// ID returns the name of the repository, or one made of its URL.
+func (r Repository) ID() string {
+	if r.Name != "" {
+		return r.Name
+	}
+
+	id := r.URL
+	if i := strings.Index(id, "://"); i >= 0 {
+		id = id[i+3:]
+	}
+	return strings.Trim(reRepositoryID.ReplaceAllString(id, "-"), "-.")
+}
+
+// ManagerRepository represents how a package manager adds repositories.
+type ManagerRepository struct {
+	Format  string `yaml:"format,omitempty"`  // deb, rpm-md, apk or tap, empty when repositories aren't supported
+	Path    string `yaml:"path,omitempty"`    // dir of the repository files, or file listing the repositories
+	Keys    string `yaml:"keys,omitempty"`    // dir of the signing keys
+	Fetch   string `yaml:"fetch,omitempty"`   // downloads a key, followed by the file and the URL
+	Refresh bool   `yaml:"refresh,omitempty"` // whether the package index is updated after a change
+}
+
+// AddRepository adds a repository and its signing key, the commands can run
+// again without adding it twice.
+func (m Manager) AddRepository(r Repository) (string, error) {
+	var cmd []string
+	switch m.Repository.Format {
+	case RepositoryDeb:
+		file, key, err := m.repositoryFiles(r)
+		if err != nil {
+			return "", err
+		}
+
+		format := `deb %s %s %s\n`
+		args := []string{quote(r.URL)}
+		if r.Key != "" {
+			cmd = append(cmd, m.fetchKey(r.Key, key))
+			format = `deb [signed-by=%s] %s %s %s\n`
+			args = append([]string{quote(key)}, args...)
+		}
+
+		suite := codename
+		if r.Suite != "" {
+			suite = quote(r.Suite)
+		}
+		components := r.Components
+		if len(components) == 0 {
+			components = []string{"main"}
+		}
+		args = append(args, suite, quote(strings.Join(components, " ")))
+
+		cmd = append(cmd, fmt.Sprintf("mkdir -p %s && printf %s %s > %s", quote(m.Repository.Path), quote(format), strings.Join(args, " "), quote(file)))
+	case RepositoryRPMMD:
+		file, _, err := m.repositoryFiles(r)
+		if err != nil {
+			return "", err
+		}
+
+		lines := []string{"[" + r.ID() + "]", "name=" + r.ID(), "baseurl=" + r.URL, "enabled=1"}
+		if r.Key != "" {
+			lines = append(lines, "gpgcheck=1", "gpgkey="+r.Key)
+		} else {
+			lines = append(lines, "gpgcheck=0")
+		}
+		cmd = append(cmd, fmt.Sprintf("mkdir -p %s && printf '%%s\\n' %s > %s", quote(m.Repository.Path), quoteAll(lines), quote(file)))
+	case RepositoryApk:
+		if r.Key != "" {
+			cmd = append(cmd, m.fetchKey(r.Key, path.Join(m.Repository.Keys, path.Base(r.Key))))
+		}
+		line := quote(r.URL)
+		cmd = append(cmd, fmt.Sprintf("{ grep -qxF %s %s || echo %s >> %s; }", line, quote(m.Repository.Path), line, quote(m.Repository.Path)))
+	case RepositoryTap:
+		if r.Key != "" {
+			return "", errors.New("repository signing keys aren't supported")
+		}
+		tap, remote := brewTap(r)
+		args := []string{m.Commands.Install, "tap", quote(tap)}
+		if remote != "" {
+			args = append(args, quote(remote))
+		}
+		cmd = append(cmd, fmt.Sprintf("{ %s tap | grep -qxF %s || %s; }", m.Commands.Install, quote(tap), strings.Join(args, " ")))
+	case "":
+		return "", errors.New("repositories aren't supported")
+	default:
+		return "", errors.Errorf("unknown repository format %s", m.Repository.Format)
+	}
+
+	if m.Repository.Refresh {
+		cmd = append(cmd, m.Update())
+	}
+	return strings.Join(cmd, " && "), nil
+}
+
+// RemoveRepository removes a repository and its signing key, nothing is done
+// when it isn't there.
+func (m Manager) RemoveRepository(r Repository) (string, error) {
+	var cmd []string
+	switch m.Repository.Format {
+	case RepositoryDeb:
+		file, key, err := m.repositoryFiles(r)
+		if err != nil {
+			return "", err
+		}
+		key = strings.TrimSuffix(key, path.Ext(key))
+		cmd = append(cmd, fmt.Sprintf("rm -f %s %s %s", quote(file), quote(key+".asc"), quote(key+".gpg")))
+	case RepositoryRPMMD:
+		file, _, err := m.repositoryFiles(r)
+		if err != nil {
+			return "", err
+		}
+		cmd = append(cmd, fmt.Sprintf("rm -f %s", quote(file)))
+	case RepositoryApk:
+		file, line := quote(m.Repository.Path), quote(r.URL)
+		cmd = append(cmd, fmt.Sprintf("if grep -qxF %s %s; then { grep -vxF %s %s || true; } > %s.droplet && cat %s.droplet > %s && rm -f %s.droplet; fi",
+			line, file, line, file, file, file, file, file))
+		if r.Key != "" {
+			cmd = append(cmd, fmt.Sprintf("rm -f %s", quote(path.Join(m.Repository.Keys, path.Base(r.Key)))))
+		}
+	case RepositoryTap:
+		tap, _ := brewTap(r)
+		cmd = append(cmd, fmt.Sprintf("if %s tap | grep -qxF %s; then %s untap %s; fi", m.Commands.Install, quote(tap), m.Commands.Install, quote(tap)))
+	case "":
+		return "", errors.New("repositories aren't supported")
+	default:
+		return "", errors.Errorf("unknown repository format %s", m.Repository.Format)
+	}
+
+	if m.Repository.Refresh {
+		cmd = append(cmd, m.Update())
+	}
+	return strings.Join(cmd, " && "), nil
+}
+
+// repositoryFiles returns the paths of the repository file and of the signing
+// key of a repository.
+func (m Manager) repositoryFiles(r Repository) (string, string, error) {
+	id := r.ID()
+	if !reRepositoryName.MatchString(id) {
+		return "", "", errors.Errorf("invalid repository name %q, only letters, digits, '_', '.' and '-' are allowed", id)
+	}
+
+	ext := ".list"
+	if m.Repository.Format == RepositoryRPMMD {
+		ext = ".repo"
+	}
+	keyExt := ".asc"
+	if strings.HasSuffix(r.Key, ".gpg") {
+		keyExt = ".gpg"
+	}
+	return path.Join(m.Repository.Path, id+ext), path.Join(m.Repository.Keys, id+keyExt), nil
+}
+
+// fetchKey downloads a signing key unless it is already there.
+func (m Manager) fetchKey(url string, file string) string {
+	return fmt.Sprintf("mkdir -p %s && { [ -s %s ] || %s %s %s; }",
+		quote(path.Dir(file)), quote(file), m.Repository.Fetch, quote(file), quote(url))
+}
+
+// brewTap returns the tap of a repository and its remote, if any.
+func brewTap(r Repository) (string, string) {
+	if r.Name == "" {
+		return r.URL, ""
+	}
+	return r.Name, r.URL
+}
+
+// quote quotes a word for the shell.
+func quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if reShellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func quoteAll(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = quote(w)
+	}
+	return strings.Join(quoted, " ")
+}
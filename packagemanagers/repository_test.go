@@ -0,0 +1,226 @@
+package packagemanagers
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepositoryID(t *testing.T) {
+	tests := []struct {
+		r        Repository
+		expected string
+	}{
+		{Repository{Name: "nginx", URL: "https://nginx.org/packages/debian"}, "nginx"},
+		{Repository{URL: "https://nginx.org/packages/debian"}, "nginx.org-packages-debian"},
+		{Repository{URL: "http://example.com/repo/"}, "example.com-repo"},
+		{Repository{URL: "homebrew/cask"}, "homebrew-cask"},
+	}
+	for _, test := range tests {
+		if res := test.r.ID(); res != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.r.URL, test.expected, res)
+		}
+	}
+}
+
+func TestAddRepository(t *testing.T) {
+	tests := []struct {
+		manager  string
+		r        Repository
+		expected string
+	}{
+		{
+			"apt",
+			Repository{Name: "nginx", URL: "https://nginx.org/packages/debian", Key: "https://nginx.org/keys/nginx_signing.key", Suite: "bookworm", Components: []string{"nginx"}},
+			`mkdir -p /etc/apt/keyrings && { [ -s /etc/apt/keyrings/nginx.asc ] || curl -fsSL -o /etc/apt/keyrings/nginx.asc https://nginx.org/keys/nginx_signing.key; } && ` +
+				`mkdir -p /etc/apt/sources.list.d && printf 'deb [signed-by=%s] %s %s %s\n' /etc/apt/keyrings/nginx.asc https://nginx.org/packages/debian bookworm nginx > /etc/apt/sources.list.d/nginx.list && ` +
+				`DEBIAN_FRONTEND=noninteractive apt -y update`,
+		},
+		{
+			"apt",
+			Repository{URL: "https://example.com/debian"},
+			`mkdir -p /etc/apt/sources.list.d && printf 'deb %s %s %s\n' https://example.com/debian "$(. /etc/os-release && echo "$VERSION_CODENAME")" main > /etc/apt/sources.list.d/example.com-debian.list && ` +
+				`DEBIAN_FRONTEND=noninteractive apt -y update`,
+		},
+		{
+			"dnf",
+			Repository{Name: "nginx", URL: "https://nginx.org/packages/centos/$releasever/$basearch/", Key: "https://nginx.org/keys/nginx_signing.key"},
+			`mkdir -p /etc/yum.repos.d && printf '%s\n' '[nginx]' name=nginx 'baseurl=https://nginx.org/packages/centos/$releasever/$basearch/' enabled=1 gpgcheck=1 gpgkey=https://nginx.org/keys/nginx_signing.key > /etc/yum.repos.d/nginx.repo`,
+		},
+		{
+			"zypper",
+			Repository{Name: "nginx", URL: "https://nginx.org/packages/sles/15"},
+			`mkdir -p /etc/zypp/repos.d && printf '%s\n' '[nginx]' name=nginx baseurl=https://nginx.org/packages/sles/15 enabled=1 gpgcheck=0 > /etc/zypp/repos.d/nginx.repo`,
+		},
+		{
+			"apk",
+			Repository{URL: "https://nginx.org/packages/alpine/v3.13/main", Key: "https://nginx.org/keys/nginx_signing.rsa.pub"},
+			`mkdir -p /etc/apk/keys && { [ -s /etc/apk/keys/nginx_signing.rsa.pub ] || wget -qO /etc/apk/keys/nginx_signing.rsa.pub https://nginx.org/keys/nginx_signing.rsa.pub; } && ` +
+				`{ grep -qxF https://nginx.org/packages/alpine/v3.13/main /etc/apk/repositories || echo https://nginx.org/packages/alpine/v3.13/main >> /etc/apk/repositories; }`,
+		},
+		{
+			"brew",
+			Repository{URL: "homebrew/cask"},
+			`{ brew tap | grep -qxF homebrew/cask || brew tap homebrew/cask; }`,
+		},
+		{
+			"brew",
+			Repository{Name: "user/tools", URL: "https://example.com/tools.git"},
+			`{ brew tap | grep -qxF user/tools || brew tap user/tools https://example.com/tools.git; }`,
+		},
+	}
+	for _, test := range tests {
+		res, err := GetManager(test.manager).AddRepository(test.r)
+		if err != nil {
+			t.Errorf("%s %s: unexpected error %v", test.manager, test.r.URL, err)
+			continue
+		}
+		if res != test.expected {
+			t.Errorf("%s %s: expected\n%s\ngot\n%s", test.manager, test.r.URL, test.expected, res)
+		}
+	}
+}
+
+func TestRemoveRepository(t *testing.T) {
+	tests := []struct {
+		manager  string
+		r        Repository
+		expected string
+	}{
+		{
+			"apt",
+			Repository{Name: "nginx", URL: "https://nginx.org/packages/debian"},
+			`rm -f /etc/apt/sources.list.d/nginx.list /etc/apt/keyrings/nginx.asc /etc/apt/keyrings/nginx.gpg && DEBIAN_FRONTEND=noninteractive apt -y update`,
+		},
+		{
+			"yum",
+			Repository{URL: "https://example.com/el8"},
+			`rm -f /etc/yum.repos.d/example.com-el8.repo`,
+		},
+		{
+			"brew",
+			Repository{URL: "homebrew/cask"},
+			`if brew tap | grep -qxF homebrew/cask; then brew untap homebrew/cask; fi`,
+		},
+	}
+	for _, test := range tests {
+		res, err := GetManager(test.manager).RemoveRepository(test.r)
+		if err != nil {
+			t.Errorf("%s %s: unexpected error %v", test.manager, test.r.URL, err)
+			continue
+		}
+		if res != test.expected {
+			t.Errorf("%s %s: expected\n%s\ngot\n%s", test.manager, test.r.URL, test.expected, res)
+		}
+	}
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	tests := []struct {
+		manager  string
+		r        Repository
+		expected string
+	}{
+		{"pacman", Repository{URL: "https://example.com/arch"}, "repositories aren't supported"},
+		{"pip", Repository{URL: "https://example.com/simple"}, "repositories aren't supported"},
+		{"brew", Repository{URL: "homebrew/cask", Key: "https://example.com/key"}, "repository signing keys aren't supported"},
+		{"apt", Repository{Name: "../nginx", URL: "https://nginx.org/packages/debian"}, `invalid repository name "../nginx", only letters, digits, '_', '.' and '-' are allowed`},
+		{"dnf", Repository{Name: "my repo", URL: "https://example.com/el8"}, `invalid repository name "my repo", only letters, digits, '_', '.' and '-' are allowed`},
+	}
+	for _, test := range tests {
+		_, err := GetManager(test.manager).AddRepository(test.r)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%s %s: expected the error %q, got %v", test.manager, test.r.URL, test.expected, err)
+		}
+	}
+
+	_, err := GetManager("pacman").RemoveRepository(Repository{URL: "https://example.com/arch"})
+	if err == nil || err.Error() != "repositories aren't supported" {
+		t.Errorf("pacman: expected the error \"repositories aren't supported\", got %v", err)
+	}
+}
+
+func TestRepositoryRun(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	for _, name := range []string{"apt", "dnf", "apk"} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "repository")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			// The repositories are added to the temp dir without refreshing
+			// the package index, the keys are fetched by a shell function
+			m := *GetManager(name)
+			m.Repository.Path = filepath.Join(dir, "repos")
+			kept := ""
+			if m.Repository.Format == RepositoryApk {
+				// The other repositories of apk are kept
+				m.Repository.Path = filepath.Join(dir, "repositories")
+				kept = "repositories: https://dl-cdn.alpinelinux.org/alpine/v3.13/main"
+				if err := ioutil.WriteFile(m.Repository.Path, []byte("https://dl-cdn.alpinelinux.org/alpine/v3.13/main\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m.Repository.Keys = filepath.Join(dir, "keys")
+			m.Repository.Fetch = "fetch"
+			m.Repository.Refresh = false
+
+			r := Repository{Name: "app", URL: "https://example.com/repo", Key: "https://example.com/key.asc", Suite: "stable"}
+			add, err := m.AddRepository(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			remove, err := m.RemoveRepository(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			run := func(cmd string) {
+				t.Helper()
+				out, err := exec.Command(bash, "-c", `set -euo pipefail; fetch() { echo "$2" > "$1"; }; `+cmd).CombinedOutput()
+				if err != nil {
+					t.Fatalf("%v: %s\n%s", err, out, cmd)
+				}
+			}
+			files := func() string {
+				t.Helper()
+				res := []string{}
+				filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+					if err == nil && !info.IsDir() {
+						content, _ := ioutil.ReadFile(file)
+						rel, _ := filepath.Rel(dir, file)
+						res = append(res, rel+": "+strings.TrimSpace(string(content)))
+					}
+					return nil
+				})
+				return strings.Join(res, "\n")
+			}
+
+			// Adding or removing the repository again changes nothing
+			run(add)
+			added := files()
+			run(add)
+			if res := files(); res != added {
+				t.Errorf("adding the repository again changed\n%s\ninto\n%s", added, res)
+			}
+			if !strings.Contains(added, "https://example.com/repo") || !strings.Contains(added, "https://example.com/key.asc") {
+				t.Errorf("expected the repository and its key, got\n%s", added)
+			}
+
+			run(remove)
+			run(remove)
+			if res := files(); res != kept {
+				t.Errorf("expected the repository and its key to be removed, got\n%s", res)
+			}
+		})
+	}
+}
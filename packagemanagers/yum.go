@@ -2,20 +2,31 @@ package packagemanagers
 
 func init() {
 	AddManager("yum", &Manager{
-		commands: ManagerCommands{
-			install: "yum",
-			update:  "yum",
-			upgrade: "yum",
-			remove:  "yum",
-			clean:   "yum",
+		Commands: ManagerCommands{
+			Install: "yum",
+			Update:  "yum",
+			Upgrade: "yum",
+			Remove:  "yum",
+			Clean:   "yum",
 		},
-		flags: ManagerFlags{
-			install: []string{"add"},
-			update:  []string{"update"},
-			upgrade: []string{"makecache"},
-			remove:  []string{"remove"},
-			clean:   []string{"clean", "all"},
-			global:  []string{"-y"},
+		Flags: ManagerFlags{
+			Install:        []string{"install"},
+			Update:         []string{"makecache"},
+			Upgrade:        []string{"upgrade"},
+			Remove:         []string{"remove"},
+			Clean:          []string{"clean", "all"},
+			NonInteractive: []string{"-y"},
+		},
+		Pin: ManagerPin{
+			Separator: "-",
+		},
+		Repository: ManagerRepository{
+			Format: RepositoryRPMMD,
+			Path:   "/etc/yum.repos.d",
+		},
+		Query: ManagerQuery{
+			Installed: `rpm -q {package} >/dev/null 2>&1`,
+			Version:   `rpm -q --qf '%{VERSION}-%{RELEASE}' {package}`,
 		},
 	})
 }
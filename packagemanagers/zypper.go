@@ -2,20 +2,33 @@ package packagemanagers
 
 func init() {
 	AddManager("zypper", &Manager{
-		commands: ManagerCommands{
-			install: "zypper",
-			update:  "zypper",
-			upgrade: "zypper",
-			remove:  "zypper",
-			clean:   "zypper",
+		Commands: ManagerCommands{
+			Install: "zypper",
+			Update:  "zypper",
+			Upgrade: "zypper",
+			Remove:  "zypper",
+			Clean:   "zypper",
 		},
-		flags: ManagerFlags{
-			install: []string{"install", "--allow-downgrade"},
-			update:  []string{"update"},
-			upgrade: []string{"upgrade"},
-			remove:  []string{"remove"},
-			clean:   []string{"clean", "-a"},
-			global:  []string{"--non-interactive", "--gpg-auto-import-keys"},
+		Flags: ManagerFlags{
+			Install:        []string{"install", "--allow-downgrade"},
+			Update:         []string{"update"},
+			Upgrade:        []string{"upgrade"},
+			Remove:         []string{"remove"},
+			Clean:          []string{"clean", "-a"},
+			Global:         []string{"--gpg-auto-import-keys"},
+			NonInteractive: []string{"--non-interactive"},
+		},
+		Pin: ManagerPin{
+			Separator: "=",
+			Ranges:    true,
+		},
+		Repository: ManagerRepository{
+			Format: RepositoryRPMMD,
+			Path:   "/etc/zypp/repos.d",
+		},
+		Query: ManagerQuery{
+			Installed: `rpm -q {package} >/dev/null 2>&1`,
+			Version:   `rpm -q --qf '%{VERSION}-%{RELEASE}' {package}`,
 		},
 	})
 }